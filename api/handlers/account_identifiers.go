@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/resolver"
+)
+
+// CreateAccountIdentifier registers a card/account number, UPI VPA or issuer on an account
+func CreateAccountIdentifier(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid account ID"))
+		return
+	}
+
+	var req models.CreateAccountIdentifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	value, err := resolver.NormalizeIdentifier(req.Type, req.Value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = db.DB.QueryRow("SELECT user_id FROM accounts WHERE id = $1", accountID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Account not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get account", "error", err, "accountId", accountID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create account identifier"))
+		return
+	}
+
+	if ownerID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "You don't have permission to update this account"))
+		return
+	}
+
+	identifier, err := insertAccountIdentifier(db.DB, userID, accountID, req.Type, value)
+	if err != nil {
+		logger.Log.Errorw("Failed to create account identifier", "error", err, "accountId", accountID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create account identifier"))
+		return
+	}
+	if identifier == nil {
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrCodeConflict, "Account already has this identifier"))
+		return
+	}
+
+	logger.Log.Infow("Account identifier created", "identifierId", identifier.ID, "accountId", accountID, "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(identifier))
+}
+
+// DeleteAccountIdentifier removes an identifier from an account
+func DeleteAccountIdentifier(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid account ID"))
+		return
+	}
+
+	identifierID, err := uuid.Parse(c.Param("identifierId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid identifier ID"))
+		return
+	}
+
+	result, err := db.DB.Exec("DELETE FROM account_identifiers WHERE id = $1 AND account_id = $2 AND user_id = $3", identifierID, accountID, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to delete account identifier", "error", err, "identifierId", identifierID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete account identifier"))
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Account identifier not found"))
+		return
+	}
+
+	logger.Log.Infow("Account identifier deleted", "identifierId", identifierID, "accountId", accountID, "userId", userID)
+	c.Status(http.StatusNoContent)
+}
+
+// loadAccountIdentifiers returns all of the user's identifiers grouped by account
+func loadAccountIdentifiers(q dbExecutor, userID uuid.UUID) (map[uuid.UUID][]models.AccountIdentifier, error) {
+	rows, err := q.Query(`
+		SELECT id, account_id, type, value, created_at
+		FROM account_identifiers
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identifiers := map[uuid.UUID][]models.AccountIdentifier{}
+	for rows.Next() {
+		var identifier models.AccountIdentifier
+		if err := rows.Scan(&identifier.ID, &identifier.AccountID, &identifier.Type, &identifier.Value, &identifier.CreatedAt); err != nil {
+			return nil, err
+		}
+		identifiers[identifier.AccountID] = append(identifiers[identifier.AccountID], identifier)
+	}
+	return identifiers, rows.Err()
+}
+
+// insertAccountIdentifier stores an already normalised identifier. It returns nil
+// without an error if the account already has the identifier.
+func insertAccountIdentifier(q dbExecutor, userID, accountID uuid.UUID, identifierType, value string) (*models.AccountIdentifier, error) {
+	var identifier models.AccountIdentifier
+	err := q.QueryRow(`
+		INSERT INTO account_identifiers (user_id, account_id, type, value, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (account_id, type, value) DO NOTHING
+		RETURNING id, account_id, type, value, created_at
+	`, userID, accountID, identifierType, value, time.Now()).Scan(&identifier.ID, &identifier.AccountID, &identifier.Type, &identifier.Value, &identifier.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identifier, nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/sooraj1002/expense-tracker/db"
 	"github.com/sooraj1002/expense-tracker/logger"
 	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/resolver"
 )
 
 // GetAccounts retrieves all user accounts
@@ -26,7 +27,7 @@ func GetAccounts(c *gin.Context) {
 	}
 
 	rows, err := db.DB.Query(`
-		SELECT id, user_id, name, initial_balance, current_balance, total_spent, created_at, updated_at
+		SELECT id, user_id, name, initial_balance, current_balance, total_spent, total_income, created_at, updated_at
 		FROM accounts
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -44,7 +45,7 @@ func GetAccounts(c *gin.Context) {
 	accounts := []models.Account{}
 	for rows.Next() {
 		var acc models.Account
-		err := rows.Scan(&acc.ID, &acc.UserID, &acc.Name, &acc.InitialBalance, &acc.CurrentBalance, &acc.TotalSpent, &acc.CreatedAt, &acc.UpdatedAt)
+		err := rows.Scan(&acc.ID, &acc.UserID, &acc.Name, &acc.InitialBalance, &acc.CurrentBalance, &acc.TotalSpent, &acc.TotalIncome, &acc.CreatedAt, &acc.UpdatedAt)
 		if err != nil {
 			logger.Log.Errorw("Failed to scan account", "error", err)
 			continue
@@ -52,6 +53,22 @@ func GetAccounts(c *gin.Context) {
 		accounts = append(accounts, acc)
 	}
 
+	identifiers, err := loadAccountIdentifiers(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get account identifiers", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to retrieve accounts",
+		))
+		return
+	}
+	for i := range accounts {
+		accounts[i].Identifiers = identifiers[accounts[i].ID]
+		if accounts[i].Identifiers == nil {
+			accounts[i].Identifiers = []models.AccountIdentifier{}
+		}
+	}
+
 	c.JSON(http.StatusOK, models.NewSuccessResponse(accounts))
 }
 
@@ -75,14 +92,38 @@ func CreateAccount(c *gin.Context) {
 		return
 	}
 
+	for i, identifier := range req.Identifiers {
+		value, err := resolver.NormalizeIdentifier(identifier.Type, identifier.Value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				models.ErrCodeInvalidInput,
+				err.Error(),
+			))
+			return
+		}
+		req.Identifiers[i].Value = value
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to create account",
+		))
+		return
+	}
+	defer tx.Rollback()
+
 	var account models.Account
 	now := time.Now()
-	err = db.DB.QueryRow(`
+	err = tx.QueryRow(`
 		INSERT INTO accounts (user_id, name, initial_balance, current_balance, total_spent, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, user_id, name, initial_balance, current_balance, total_spent, created_at, updated_at
+		RETURNING id, user_id, name, initial_balance, current_balance, total_spent, total_income, created_at, updated_at
 	`, userID, req.Name, req.InitialBalance, req.InitialBalance, 0, now, now).Scan(
-		&account.ID, &account.UserID, &account.Name, &account.InitialBalance, &account.CurrentBalance, &account.TotalSpent, &account.CreatedAt, &account.UpdatedAt,
+		&account.ID, &account.UserID, &account.Name, &account.InitialBalance, &account.CurrentBalance, &account.TotalSpent, &account.TotalIncome, &account.CreatedAt, &account.UpdatedAt,
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to create account", "error", err, "userId", userID)
@@ -93,6 +134,31 @@ func CreateAccount(c *gin.Context) {
 		return
 	}
 
+	account.Identifiers = []models.AccountIdentifier{}
+	for _, identifier := range req.Identifiers {
+		created, err := insertAccountIdentifier(tx, userID, account.ID, identifier.Type, identifier.Value)
+		if err != nil {
+			logger.Log.Errorw("Failed to create account identifier", "error", err, "userId", userID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+				models.ErrCodeDatabaseError,
+				"Failed to create account",
+			))
+			return
+		}
+		if created != nil {
+			account.Identifiers = append(account.Identifiers, *created)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to create account",
+		))
+		return
+	}
+
 	logger.Log.Infow("Account created", "accountId", account.ID, "userId", userID)
 
 	c.JSON(http.StatusCreated, models.NewSuccessResponse(account))
@@ -167,9 +233,9 @@ func UpdateAccount(c *gin.Context) {
 		UPDATE accounts
 		SET name = $1, initial_balance = $2, current_balance = $3, updated_at = $4
 		WHERE id = $5
-		RETURNING id, user_id, name, initial_balance, current_balance, total_spent, created_at, updated_at
+		RETURNING id, user_id, name, initial_balance, current_balance, total_spent, total_income, created_at, updated_at
 	`, req.Name, req.InitialBalance, newCurrentBalance, time.Now(), accountID).Scan(
-		&account.ID, &account.UserID, &account.Name, &account.InitialBalance, &account.CurrentBalance, &account.TotalSpent, &account.CreatedAt, &account.UpdatedAt,
+		&account.ID, &account.UserID, &account.Name, &account.InitialBalance, &account.CurrentBalance, &account.TotalSpent, &account.TotalIncome, &account.CreatedAt, &account.UpdatedAt,
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to update account", "error", err, "accountId", accountID)
@@ -180,6 +246,20 @@ func UpdateAccount(c *gin.Context) {
 		return
 	}
 
+	identifiers, err := loadAccountIdentifiers(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get account identifiers", "error", err, "accountId", accountID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to update account",
+		))
+		return
+	}
+	account.Identifiers = identifiers[accountID]
+	if account.Identifiers == nil {
+		account.Identifiers = []models.AccountIdentifier{}
+	}
+
 	logger.Log.Infow("Account updated", "accountId", accountID, "userId", userID)
 
 	c.JSON(http.StatusOK, models.NewSuccessResponse(account))
@@ -252,6 +332,26 @@ func DeleteAccount(c *gin.Context) {
 		return
 	}
 
+	// Check if account has income
+	var incomeCount int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM incomes WHERE account_id = $1", accountID).Scan(&incomeCount)
+	if err != nil {
+		logger.Log.Errorw("Failed to check income count", "error", err, "accountId", accountID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to delete account",
+		))
+		return
+	}
+
+	if incomeCount > 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrCodeInvalidInput,
+			"Cannot delete account with existing income",
+		))
+		return
+	}
+
 	_, err = db.DB.Exec("DELETE FROM accounts WHERE id = $1", accountID)
 	if err != nil {
 		logger.Log.Errorw("Failed to delete account", "error", err, "accountId", accountID)
@@ -284,10 +384,11 @@ func GetAccountSummary(c *gin.Context) {
 			COALESCE(SUM(initial_balance), 0),
 			COALESCE(SUM(current_balance), 0),
 			COALESCE(SUM(total_spent), 0),
+			COALESCE(SUM(total_income), 0),
 			COUNT(*)
 		FROM accounts
 		WHERE user_id = $1
-	`, userID).Scan(&summary.TotalInitialBalance, &summary.TotalCurrentBalance, &summary.TotalSpent, &summary.AccountCount)
+	`, userID).Scan(&summary.TotalInitialBalance, &summary.TotalCurrentBalance, &summary.TotalSpent, &summary.TotalIncome, &summary.AccountCount)
 	if err != nil {
 		logger.Log.Errorw("Failed to get account summary", "error", err, "userId", userID)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
@@ -362,8 +463,7 @@ func GetAccountExpenses(c *gin.Context) {
 	offset := (page - 1) * limit
 
 	// Build query
-	query := `SELECT id, user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, raw_data, verified, created_at, updated_at
-		FROM expenses WHERE account_id = $1`
+	query := "SELECT " + expenseColumns + " FROM expenses WHERE account_id = $1"
 	args := []interface{}{accountID}
 	argCount := 1
 
@@ -400,8 +500,7 @@ func GetAccountExpenses(c *gin.Context) {
 	expenses := []models.Expense{}
 	totalSpent := 0.0
 	for rows.Next() {
-		var exp models.Expense
-		err := rows.Scan(&exp.ID, &exp.UserID, &exp.Amount, &exp.CategoryID, &exp.AccountID, &exp.Date, &exp.Description, &exp.Source, &exp.MerchantID, &exp.MerchantName, &exp.LocationID, &exp.RawData, &exp.Verified, &exp.CreatedAt, &exp.UpdatedAt)
+		exp, err := scanExpense(rows)
 		if err != nil {
 			logger.Log.Errorw("Failed to scan expense", "error", err)
 			continue
@@ -24,13 +24,27 @@ func GetCategories(c *gin.Context) {
 		return
 	}
 
+	categoryType := c.Query("type")
+	if categoryType != "" && categoryType != models.CategoryTypeExpense && categoryType != models.CategoryTypeIncome {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrCodeInvalidInput,
+			"type must be expense or income",
+		))
+		return
+	}
+
 	// Get all categories - system defaults (user_id IS NULL) + user custom categories
-	rows, err := db.DB.Query(`
-		SELECT id, user_id, name, color, is_default, created_at, updated_at
+	query := `SELECT id, user_id, name, color, type, is_default, created_at, updated_at
 		FROM categories
-		WHERE user_id IS NULL OR user_id = $1
-		ORDER BY is_default DESC, name ASC
-	`, userID)
+		WHERE (user_id IS NULL OR user_id = $1)`
+	args := []interface{}{userID}
+	if categoryType != "" {
+		query += " AND type = $2"
+		args = append(args, categoryType)
+	}
+	query += " ORDER BY is_default DESC, name ASC"
+
+	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		logger.Log.Errorw("Failed to get categories", "error", err, "userId", userID)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
@@ -44,7 +58,7 @@ func GetCategories(c *gin.Context) {
 	categories := []models.Category{}
 	for rows.Next() {
 		var cat models.Category
-		err := rows.Scan(&cat.ID, &cat.UserID, &cat.Name, &cat.Color, &cat.IsDefault, &cat.CreatedAt, &cat.UpdatedAt)
+		err := rows.Scan(&cat.ID, &cat.UserID, &cat.Name, &cat.Color, &cat.Type, &cat.IsDefault, &cat.CreatedAt, &cat.UpdatedAt)
 		if err != nil {
 			logger.Log.Errorw("Failed to scan category", "error", err)
 			continue
@@ -75,15 +89,19 @@ func CreateCategory(c *gin.Context) {
 		return
 	}
 
+	if req.Type == "" {
+		req.Type = models.CategoryTypeExpense
+	}
+
 	// Create category
 	var category models.Category
 	now := time.Now()
 	err = db.DB.QueryRow(`
-		INSERT INTO categories (user_id, name, color, is_default, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, user_id, name, color, is_default, created_at, updated_at
-	`, userID, req.Name, req.Color, false, now, now).Scan(
-		&category.ID, &category.UserID, &category.Name, &category.Color, &category.IsDefault, &category.CreatedAt, &category.UpdatedAt,
+		INSERT INTO categories (user_id, name, color, type, is_default, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, user_id, name, color, type, is_default, created_at, updated_at
+	`, userID, req.Name, req.Color, req.Type, false, now, now).Scan(
+		&category.ID, &category.UserID, &category.Name, &category.Color, &category.Type, &category.IsDefault, &category.CreatedAt, &category.UpdatedAt,
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to create category", "error", err, "userId", userID)
@@ -172,9 +190,9 @@ func UpdateCategory(c *gin.Context) {
 		UPDATE categories
 		SET name = $1, color = $2, updated_at = $3
 		WHERE id = $4
-		RETURNING id, user_id, name, color, is_default, created_at, updated_at
+		RETURNING id, user_id, name, color, type, is_default, created_at, updated_at
 	`, req.Name, req.Color, time.Now(), categoryID).Scan(
-		&category.ID, &category.UserID, &category.Name, &category.Color, &category.IsDefault, &category.CreatedAt, &category.UpdatedAt,
+		&category.ID, &category.UserID, &category.Name, &category.Color, &category.Type, &category.IsDefault, &category.CreatedAt, &category.UpdatedAt,
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to update category", "error", err, "categoryId", categoryID)
@@ -268,6 +286,46 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
+	// Check if category has income
+	var incomeCount int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM incomes WHERE category_id = $1", categoryID).Scan(&incomeCount)
+	if err != nil {
+		logger.Log.Errorw("Failed to check income count", "error", err, "categoryId", categoryID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to delete category",
+		))
+		return
+	}
+
+	if incomeCount > 0 {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(
+			models.ErrCodeForbidden,
+			"Cannot delete category with existing income",
+		))
+		return
+	}
+
+	// Check if any rule sets this category
+	var ruleCount int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM rules WHERE set_category_id = $1", categoryID).Scan(&ruleCount)
+	if err != nil {
+		logger.Log.Errorw("Failed to check rule count", "error", err, "categoryId", categoryID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			models.ErrCodeDatabaseError,
+			"Failed to delete category",
+		))
+		return
+	}
+
+	if ruleCount > 0 {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(
+			models.ErrCodeForbidden,
+			"Cannot delete category used by rules",
+		))
+		return
+	}
+
 	// Delete category
 	_, err = db.DB.Exec("DELETE FROM categories WHERE id = $1", categoryID)
 	if err != nil {
@@ -283,3 +341,24 @@ func DeleteCategory(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// checkCategoryType verifies the category is visible to the user and of the wanted type,
+// writing an error response and returning false if not
+func checkCategoryType(c *gin.Context, userID, categoryID uuid.UUID, wantType, failMessage string) bool {
+	var categoryType string
+	err := db.DB.QueryRow("SELECT type FROM categories WHERE id = $1 AND (user_id IS NULL OR user_id = $2)", categoryID, userID).Scan(&categoryType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Category not found"))
+		return false
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get category", "error", err, "categoryId", categoryID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, failMessage))
+		return false
+	}
+	if categoryType != wantType {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Category must be an "+wantType+" category"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Page sizes of the change log
+const (
+	defaultChangesLimit = 500
+	maxChangesLimit     = 1000
+)
+
+// GetChanges pages through the user's change log, returning the entries
+// numbered after since in order
+func GetChanges(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var since int64
+	if s := c.Query("since"); s != "" {
+		since, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "since must be a sequence number"))
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit < 1 || limit > maxChangesLimit {
+		limit = defaultChangesLimit
+	}
+
+	// One more than the page tells whether there is another page
+	rows, err := db.DB.Query(`
+		SELECT seq, entity_type, entity_id, operation, changed_at FROM change_log
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq ASC
+		LIMIT $3
+	`, userID, since, limit+1)
+	if err != nil {
+		logger.Log.Errorw("Failed to get changes", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve changes"))
+		return
+	}
+	defer rows.Close()
+
+	resp := models.ChangesResponse{Changes: []models.Change{}, NextSince: since}
+	for rows.Next() {
+		var change models.Change
+		if err := rows.Scan(&change.Seq, &change.EntityType, &change.EntityID, &change.Operation, &change.ChangedAt); err != nil {
+			logger.Log.Errorw("Failed to get changes", "error", err, "userId", userID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve changes"))
+			return
+		}
+		if len(resp.Changes) == limit {
+			resp.HasMore = true
+			break
+		}
+		resp.Changes = append(resp.Changes, change)
+		resp.NextSince = change.Seq
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Errorw("Failed to get changes", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve changes"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(resp))
+}
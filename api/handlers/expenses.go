@@ -10,10 +10,16 @@ import (
 	"github.com/google/uuid"
 	"github.com/sooraj1002/expense-tracker/api/middleware"
 	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/location"
 	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/merchant"
 	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/place"
+	"github.com/sooraj1002/expense-tracker/rules"
 )
 
+const expenseColumns = "id, user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, raw_data, verified, created_at, updated_at"
+
 // GetExpenses retrieves expenses with filters and pagination
 func GetExpenses(c *gin.Context) {
 	userID, err := middleware.GetUserID(c)
@@ -36,8 +42,7 @@ func GetExpenses(c *gin.Context) {
 	}
 	offset := (page - 1) * limit
 
-	query := `SELECT id, user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, raw_data, verified, created_at, updated_at
-		FROM expenses WHERE user_id = $1`
+	query := "SELECT " + expenseColumns + " FROM expenses WHERE user_id = $1"
 	args := []interface{}{userID}
 	argCount := 1
 
@@ -77,11 +82,12 @@ func GetExpenses(c *gin.Context) {
 
 	expenses := []models.Expense{}
 	for rows.Next() {
-		var exp models.Expense
-		err := rows.Scan(&exp.ID, &exp.UserID, &exp.Amount, &exp.CategoryID, &exp.AccountID, &exp.Date, &exp.Description, &exp.Source, &exp.MerchantID, &exp.MerchantName, &exp.LocationID, &exp.RawData, &exp.Verified, &exp.CreatedAt, &exp.UpdatedAt)
-		if err == nil {
-			expenses = append(expenses, exp)
+		exp, err := scanExpense(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan expense", "error", err)
+			continue
 		}
+		expenses = append(expenses, exp)
 	}
 
 	c.JSON(http.StatusOK, models.NewSuccessResponse(expenses))
@@ -101,6 +107,10 @@ func CreateExpense(c *gin.Context) {
 		return
 	}
 
+	if ok := checkCategoryType(c, userID, req.CategoryID, models.CategoryTypeExpense, "Failed to create expense"); !ok {
+		return
+	}
+
 	// Start transaction
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -110,34 +120,13 @@ func CreateExpense(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// Create expense
-	var expense models.Expense
-	now := time.Now()
-	err = tx.QueryRow(`
-		INSERT INTO expenses (user_id, amount, category_id, account_id, date, description, source, merchant_name, verified, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, raw_data, verified, created_at, updated_at
-	`, userID, req.Amount, req.CategoryID, req.AccountID, req.Date, req.Description, "manual", req.MerchantName, true, now, now).Scan(
-		&expense.ID, &expense.UserID, &expense.Amount, &expense.CategoryID, &expense.AccountID, &expense.Date, &expense.Description, &expense.Source, &expense.MerchantID, &expense.MerchantName, &expense.LocationID, &expense.RawData, &expense.Verified, &expense.CreatedAt, &expense.UpdatedAt,
-	)
+	expense, err := insertExpense(tx, userID, req, true)
 	if err != nil {
 		logger.Log.Errorw("Failed to create expense", "error", err)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create expense"))
 		return
 	}
 
-	// Update account balance
-	_, err = tx.Exec(`
-		UPDATE accounts
-		SET current_balance = current_balance - $1, total_spent = total_spent + $1, updated_at = $2
-		WHERE id = $3 AND user_id = $4
-	`, req.Amount, now, req.AccountID, userID)
-	if err != nil {
-		logger.Log.Errorw("Failed to update account balance", "error", err)
-		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create expense"))
-		return
-	}
-
 	if err = tx.Commit(); err != nil {
 		logger.Log.Errorw("Failed to commit transaction", "error", err)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create expense"))
@@ -148,6 +137,76 @@ func CreateExpense(c *gin.Context) {
 	c.JSON(http.StatusCreated, models.NewSuccessResponse(expense))
 }
 
+// insertExpense saves a manual expense for the user and lowers the account balance.
+// The caller chose the category and whether it is verified, so rules only fill in a
+// missing description. The expense is linked to its merchant and to the nearest
+// location fix; without a merchant, it carries a category suggestion from the place
+// it was spent at.
+func insertExpense(q dbExecutor, userID uuid.UUID, req models.CreateExpenseRequest, verified bool) (models.Expense, error) {
+	merchantID, err := merchant.Upsert(q, userID, req.MerchantName)
+	if err != nil {
+		return models.Expense{}, err
+	}
+
+	description := req.Description
+	if description == "" {
+		evaluation, err := rules.Run(q, userID, rules.Input{
+			MerchantName: req.MerchantName,
+			Amount:       req.Amount,
+			AccountID:    &req.AccountID,
+			Date:         req.Date,
+			Source:       "manual",
+		})
+		if err != nil {
+			return models.Expense{}, err
+		}
+		if evaluation.Description != nil {
+			description = *evaluation.Description
+			if err := rules.RecordUse(q, evaluation.DescriptionRuleID); err != nil {
+				return models.Expense{}, err
+			}
+		}
+	}
+
+	locationID, err := location.Nearest(q, userID, req.Date, locationLimits())
+	if err != nil {
+		return models.Expense{}, err
+	}
+
+	now := time.Now()
+	expense, err := scanExpense(q.QueryRow(`
+		INSERT INTO expenses (user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING `+expenseColumns,
+		userID, req.Amount, req.CategoryID, req.AccountID, req.Date, description, "manual", merchantID, req.MerchantName, locationID, verified, now, now,
+	))
+	if err != nil {
+		return models.Expense{}, err
+	}
+
+	if err := merchant.Refresh(q, merchantID); err != nil {
+		return models.Expense{}, err
+	}
+
+	// Without a merchant, what the user usually spends on at this place is the best hint
+	if req.MerchantName == "" && locationID != nil {
+		expense.Suggestion, err = place.SuggestCategory(q, userID, *locationID, expense.ID)
+		if err != nil {
+			return models.Expense{}, err
+		}
+	}
+
+	_, err = q.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance - $1, total_spent = total_spent + $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, req.Amount, now, req.AccountID, userID)
+	if err != nil {
+		return models.Expense{}, err
+	}
+	return expense, nil
+}
+
 // UpdateExpense updates an existing expense
 func UpdateExpense(c *gin.Context) {
 	userID, err := middleware.GetUserID(c)
@@ -170,7 +229,7 @@ func UpdateExpense(c *gin.Context) {
 
 	// Get existing expense
 	var oldExpense models.Expense
-	err = db.DB.QueryRow("SELECT user_id, amount, account_id FROM expenses WHERE id = $1", expenseID).Scan(&oldExpense.UserID, &oldExpense.Amount, &oldExpense.AccountID)
+	err = db.DB.QueryRow("SELECT user_id, amount, account_id, merchant_id FROM expenses WHERE id = $1", expenseID).Scan(&oldExpense.UserID, &oldExpense.Amount, &oldExpense.AccountID, &oldExpense.MerchantID)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Expense not found"))
 		return
@@ -186,6 +245,21 @@ func UpdateExpense(c *gin.Context) {
 		return
 	}
 
+	if req.CategoryID != nil {
+		if ok := checkCategoryType(c, userID, *req.CategoryID, models.CategoryTypeExpense, "Failed to update expense"); !ok {
+			return
+		}
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update expense"))
+		return
+	}
+	defer tx.Rollback()
+
 	// Build update query dynamically
 	updates := []string{}
 	args := []interface{}{}
@@ -211,6 +285,20 @@ func UpdateExpense(c *gin.Context) {
 		updates = append(updates, "verified = $"+strconv.Itoa(argCount))
 		args = append(args, *req.Verified)
 	}
+	if req.MerchantName != nil {
+		merchantID, err := merchant.Upsert(tx, userID, *req.MerchantName)
+		if err != nil {
+			logger.Log.Errorw("Failed to upsert merchant", "error", err)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update expense"))
+			return
+		}
+		argCount++
+		updates = append(updates, "merchant_id = $"+strconv.Itoa(argCount))
+		args = append(args, merchantID)
+		argCount++
+		updates = append(updates, "merchant_name = $"+strconv.Itoa(argCount))
+		args = append(args, *req.MerchantName)
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "No fields to update"))
@@ -228,22 +316,24 @@ func UpdateExpense(c *gin.Context) {
 	for i := 1; i < len(updates); i++ {
 		query += ", " + updates[i]
 	}
-	query += " WHERE id = $" + strconv.Itoa(argCount)
+	query += " WHERE id = $" + strconv.Itoa(argCount) + " RETURNING " + expenseColumns
 
-	_, err = db.DB.Exec(query, args...)
+	expense, err := scanExpense(tx.QueryRow(query, args...))
 	if err != nil {
 		logger.Log.Errorw("Failed to update expense", "error", err)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update expense"))
 		return
 	}
 
-	// Get updated expense
-	var expense models.Expense
-	err = db.DB.QueryRow("SELECT id, user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, raw_data, verified, created_at, updated_at FROM expenses WHERE id = $1", expenseID).Scan(
-		&expense.ID, &expense.UserID, &expense.Amount, &expense.CategoryID, &expense.AccountID, &expense.Date, &expense.Description, &expense.Source, &expense.MerchantID, &expense.MerchantName, &expense.LocationID, &expense.RawData, &expense.Verified, &expense.CreatedAt, &expense.UpdatedAt,
-	)
-	if err != nil {
-		logger.Log.Errorw("Failed to get updated expense", "error", err)
+	// Amount, category and merchant changes all move the merchant counters
+	if err := merchant.Refresh(tx, oldExpense.MerchantID, expense.MerchantID); err != nil {
+		logger.Log.Errorw("Failed to refresh merchant", "error", err, "expenseId", expenseID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update expense"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update expense"))
 		return
 	}
@@ -268,7 +358,7 @@ func DeleteExpense(c *gin.Context) {
 
 	// Get expense details
 	var expense models.Expense
-	err = db.DB.QueryRow("SELECT user_id, amount, account_id FROM expenses WHERE id = $1", expenseID).Scan(&expense.UserID, &expense.Amount, &expense.AccountID)
+	err = db.DB.QueryRow("SELECT user_id, amount, account_id, merchant_id FROM expenses WHERE id = $1", expenseID).Scan(&expense.UserID, &expense.Amount, &expense.AccountID, &expense.MerchantID)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Expense not found"))
 		return
@@ -293,22 +383,9 @@ func DeleteExpense(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// Delete expense
-	_, err = tx.Exec("DELETE FROM expenses WHERE id = $1", expenseID)
-	if err != nil {
-		logger.Log.Errorw("Failed to delete expense", "error", err)
-		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete expense"))
-		return
-	}
-
-	// Update account balance
-	_, err = tx.Exec(`
-		UPDATE accounts
-		SET current_balance = current_balance + $1, total_spent = total_spent - $1, updated_at = $2
-		WHERE id = $3 AND user_id = $4
-	`, expense.Amount, time.Now(), expense.AccountID, userID)
-	if err != nil {
-		logger.Log.Errorw("Failed to update account balance", "error", err)
+	expense.ID = expenseID
+	if err := removeExpense(tx, userID, expense); err != nil {
+		logger.Log.Errorw("Failed to delete expense", "error", err, "expenseId", expenseID)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete expense"))
 		return
 	}
@@ -322,3 +399,35 @@ func DeleteExpense(c *gin.Context) {
 	logger.Log.Infow("Expense deleted", "expenseId", expenseID, "userId", userID)
 	c.Status(http.StatusNoContent)
 }
+
+// removeExpense deletes an expense, giving its amount back to the account and
+// updating its merchant's counters. Only the ID, amount, account and merchant
+// of the expense are used.
+func removeExpense(q dbExecutor, userID uuid.UUID, expense models.Expense) error {
+	if _, err := q.Exec("DELETE FROM expenses WHERE id = $1", expense.ID); err != nil {
+		return err
+	}
+
+	_, err := q.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance + $1, total_spent = total_spent - $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, expense.Amount, time.Now(), expense.AccountID, userID)
+	if err != nil {
+		return err
+	}
+
+	return merchant.Refresh(q, expense.MerchantID)
+}
+
+// scanExpense reads a row selected with expenseColumns
+func scanExpense(row rowScanner) (models.Expense, error) {
+	var exp models.Expense
+	var description, merchantName, rawData sql.NullString
+	err := row.Scan(&exp.ID, &exp.UserID, &exp.Amount, &exp.CategoryID, &exp.AccountID, &exp.Date, &description, &exp.Source,
+		&exp.MerchantID, &merchantName, &exp.LocationID, &rawData, &exp.Verified, &exp.CreatedAt, &exp.UpdatedAt)
+	exp.Description = description.String
+	exp.MerchantName = merchantName.String
+	exp.RawData = rawData.String
+	return exp, err
+}
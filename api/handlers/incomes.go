@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+const incomeColumns = "id, user_id, amount, category_id, account_id, date, description, source, payer_name, raw_data, verified, created_at, updated_at"
+
+// GetIncomes retrieves income with filters and pagination
+func GetIncomes(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	month, _ := strconv.Atoi(c.Query("month"))
+	year, _ := strconv.Atoi(c.Query("year"))
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	query := "SELECT " + incomeColumns + " FROM incomes WHERE user_id = $1"
+	args := []interface{}{userID}
+	argCount := 1
+
+	if year > 0 {
+		argCount++
+		query += " AND EXTRACT(YEAR FROM date) = $" + strconv.Itoa(argCount)
+		args = append(args, year)
+	}
+	if month > 0 && month <= 12 {
+		argCount++
+		query += " AND EXTRACT(MONTH FROM date) = $" + strconv.Itoa(argCount)
+		args = append(args, month)
+	}
+	for _, param := range []string{"accountId", "categoryId"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid "+param))
+			return
+		}
+		argCount++
+		if param == "accountId" {
+			query += " AND account_id = $" + strconv.Itoa(argCount)
+		} else {
+			query += " AND category_id = $" + strconv.Itoa(argCount)
+		}
+		args = append(args, id)
+	}
+
+	query += " ORDER BY date DESC"
+	argCount++
+	query += " LIMIT $" + strconv.Itoa(argCount)
+	args = append(args, limit)
+	argCount++
+	query += " OFFSET $" + strconv.Itoa(argCount)
+	args = append(args, offset)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		logger.Log.Errorw("Failed to get incomes", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve income"))
+		return
+	}
+	defer rows.Close()
+
+	incomes := []models.Income{}
+	for rows.Next() {
+		income, err := scanIncome(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan income", "error", err)
+			continue
+		}
+		incomes = append(incomes, income)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(incomes))
+}
+
+// CreateIncome records money received into an account and raises its balance
+func CreateIncome(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.CreateIncomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	if ok := checkCategoryType(c, userID, req.CategoryID, models.CategoryTypeIncome, "Failed to create income"); !ok {
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = db.DB.QueryRow("SELECT user_id FROM accounts WHERE id = $1", req.AccountID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Account not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get account", "error", err, "accountId", req.AccountID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create income"))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create income"))
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	income, err := scanIncome(tx.QueryRow(`
+		INSERT INTO incomes (user_id, amount, category_id, account_id, date, description, source, payer_name, verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+incomeColumns,
+		userID, req.Amount, req.CategoryID, req.AccountID, req.Date, req.Description, "manual", nullString(req.PayerName), true, now, now,
+	))
+	if err != nil {
+		logger.Log.Errorw("Failed to create income", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create income"))
+		return
+	}
+
+	// Update account balance
+	_, err = tx.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance + $1, total_income = total_income + $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, req.Amount, now, req.AccountID, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to update account balance", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create income"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create income"))
+		return
+	}
+
+	logger.Log.Infow("Income created", "incomeId", income.ID, "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(income))
+}
+
+// UpdateIncome updates an existing income. Changing the amount adjusts the account balance by the difference.
+func UpdateIncome(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	incomeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid income ID"))
+		return
+	}
+
+	var req models.UpdateIncomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	// Get existing income
+	var old models.Income
+	err = db.DB.QueryRow("SELECT user_id, amount, account_id FROM incomes WHERE id = $1", incomeID).Scan(&old.UserID, &old.Amount, &old.AccountID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Income not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get income", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update income"))
+		return
+	}
+
+	if old.UserID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "Permission denied"))
+		return
+	}
+
+	if req.CategoryID != nil {
+		if ok := checkCategoryType(c, userID, *req.CategoryID, models.CategoryTypeIncome, "Failed to update income"); !ok {
+			return
+		}
+	}
+
+	// Build update query dynamically
+	updates := []string{}
+	args := []interface{}{}
+	argCount := 0
+
+	if req.Amount != nil {
+		argCount++
+		updates = append(updates, "amount = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Amount)
+	}
+	if req.CategoryID != nil {
+		argCount++
+		updates = append(updates, "category_id = $"+strconv.Itoa(argCount))
+		args = append(args, *req.CategoryID)
+	}
+	if req.Date != nil {
+		argCount++
+		updates = append(updates, "date = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Date)
+	}
+	if req.Description != nil {
+		argCount++
+		updates = append(updates, "description = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Description)
+	}
+	if req.PayerName != nil {
+		argCount++
+		updates = append(updates, "payer_name = $"+strconv.Itoa(argCount))
+		args = append(args, nullString(*req.PayerName))
+	}
+	if req.Verified != nil {
+		argCount++
+		updates = append(updates, "verified = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Verified)
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "No fields to update"))
+		return
+	}
+
+	now := time.Now()
+	argCount++
+	updates = append(updates, "updated_at = $"+strconv.Itoa(argCount))
+	args = append(args, now)
+
+	argCount++
+	args = append(args, incomeID)
+
+	query := "UPDATE incomes SET " + updates[0]
+	for i := 1; i < len(updates); i++ {
+		query += ", " + updates[i]
+	}
+	query += " WHERE id = $" + strconv.Itoa(argCount) + " RETURNING " + incomeColumns
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update income"))
+		return
+	}
+	defer tx.Rollback()
+
+	income, err := scanIncome(tx.QueryRow(query, args...))
+	if err != nil {
+		logger.Log.Errorw("Failed to update income", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update income"))
+		return
+	}
+
+	if diff := income.Amount - old.Amount; diff != 0 {
+		_, err = tx.Exec(`
+			UPDATE accounts
+			SET current_balance = current_balance + $1, total_income = total_income + $1, updated_at = $2
+			WHERE id = $3 AND user_id = $4
+		`, diff, now, old.AccountID, userID)
+		if err != nil {
+			logger.Log.Errorw("Failed to update account balance", "error", err)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update income"))
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update income"))
+		return
+	}
+
+	logger.Log.Infow("Income updated", "incomeId", incomeID, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(income))
+}
+
+// DeleteIncome deletes an income and lowers the account balance again
+func DeleteIncome(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	incomeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid income ID"))
+		return
+	}
+
+	// Get income details
+	var income models.Income
+	err = db.DB.QueryRow("SELECT user_id, amount, account_id FROM incomes WHERE id = $1", incomeID).Scan(&income.UserID, &income.Amount, &income.AccountID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Income not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get income", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete income"))
+		return
+	}
+
+	if income.UserID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "Permission denied"))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete income"))
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM incomes WHERE id = $1", incomeID)
+	if err != nil {
+		logger.Log.Errorw("Failed to delete income", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete income"))
+		return
+	}
+
+	// Update account balance
+	_, err = tx.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance - $1, total_income = total_income - $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, income.Amount, time.Now(), income.AccountID, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to update account balance", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete income"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete income"))
+		return
+	}
+
+	logger.Log.Infow("Income deleted", "incomeId", incomeID, "userId", userID)
+	c.Status(http.StatusNoContent)
+}
+
+// scanIncome reads a row selected with incomeColumns
+func scanIncome(row rowScanner) (models.Income, error) {
+	var income models.Income
+	var description, payerName, rawData sql.NullString
+	err := row.Scan(&income.ID, &income.UserID, &income.Amount, &income.CategoryID, &income.AccountID, &income.Date, &description,
+		&income.Source, &payerName, &rawData, &income.Verified, &income.CreatedAt, &income.UpdatedAt)
+	income.Description = description.String
+	income.PayerName = payerName.String
+	income.RawData = rawData.String
+	return income, err
+}
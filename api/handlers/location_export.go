@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/place"
+)
+
+// Heatmap cell sizes in metres
+const (
+	defaultHeatmapCell = 500
+	minHeatmapCell     = 10
+	maxHeatmapCell     = 100000
+)
+
+type spendPoint struct {
+	expenseID    uuid.UUID
+	amount       float64
+	date         time.Time
+	categoryID   uuid.UUID
+	categoryName string
+	merchantID   *uuid.UUID
+	merchantName string
+	latitude     float64
+	longitude    float64
+}
+
+// ExportLocations downloads the user's expenses that have a location as
+// GeoJSON, either one point per expense or, with mode=heatmap, the totals
+// spent in each cell of a grid
+func ExportLocations(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	if format := c.DefaultQuery("format", "geojson"); format != "geojson" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "format must be geojson"))
+		return
+	}
+	mode := c.DefaultQuery("mode", "points")
+	if mode != "points" && mode != "heatmap" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "mode must be points or heatmap"))
+		return
+	}
+	cellSize := float64(defaultHeatmapCell)
+	if s := c.Query("cellSize"); s != "" {
+		cellSize, err = strconv.ParseFloat(s, 64)
+		if err != nil || cellSize < minHeatmapCell || cellSize > maxHeatmapCell {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "cellSize must be between 10 and 100000 metres"))
+			return
+		}
+	}
+
+	query := `
+		SELECT e.id, e.amount, e.date, e.category_id, c.name, e.merchant_id, e.merchant_name, l.latitude, l.longitude
+		FROM expenses e
+		JOIN locations l ON l.id = e.location_id
+		JOIN categories c ON c.id = e.category_id
+		WHERE e.user_id = $1`
+	args := []interface{}{userID}
+	if startDate := c.Query("startDate"); startDate != "" {
+		start, err := parseDateParam(startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid startDate"))
+			return
+		}
+		args = append(args, start)
+		query += " AND e.date >= $" + strconv.Itoa(len(args))
+	}
+	if endDate := c.Query("endDate"); endDate != "" {
+		end, err := parseDateParam(endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid endDate"))
+			return
+		}
+		// A bare date includes the whole day
+		if !strings.Contains(endDate, "T") {
+			end = end.AddDate(0, 0, 1)
+		}
+		args = append(args, end)
+		query += " AND e.date < $" + strconv.Itoa(len(args))
+	}
+	if categoryIDStr := c.Query("categoryId"); categoryIDStr != "" {
+		categoryID, err := uuid.Parse(categoryIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid categoryId"))
+			return
+		}
+		args = append(args, categoryID)
+		query += " AND e.category_id = $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY e.date ASC", args...)
+	if err != nil {
+		logger.Log.Errorw("Failed to get expense locations", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to export locations"))
+		return
+	}
+	defer rows.Close()
+
+	points := []spendPoint{}
+	for rows.Next() {
+		var p spendPoint
+		var merchantName sql.NullString
+		if err := rows.Scan(&p.expenseID, &p.amount, &p.date, &p.categoryID, &p.categoryName, &p.merchantID, &merchantName, &p.latitude, &p.longitude); err != nil {
+			logger.Log.Errorw("Failed to scan expense location", "error", err)
+			continue
+		}
+		p.merchantName = merchantName.String
+		points = append(points, p)
+	}
+	rows.Close()
+
+	var collection models.GeoJSONFeatureCollection
+	if mode == "heatmap" {
+		collection = heatmapFeatures(points, cellSize)
+	} else {
+		collection = pointFeatures(points)
+	}
+
+	body, err := json.Marshal(collection)
+	if err != nil {
+		logger.Log.Errorw("Failed to encode GeoJSON", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeInternalError, "Failed to export locations"))
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="expense-locations.geojson"`)
+	c.Data(http.StatusOK, "application/geo+json", body)
+}
+
+// pointFeatures makes one feature per expense
+func pointFeatures(points []spendPoint) models.GeoJSONFeatureCollection {
+	collection := models.GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []models.GeoJSONFeature{}}
+	for _, p := range points {
+		properties := map[string]interface{}{
+			"expenseId":  p.expenseID,
+			"amount":     p.amount,
+			"date":       p.date,
+			"categoryId": p.categoryID,
+			"category":   p.categoryName,
+		}
+		if p.merchantID != nil {
+			properties["merchantId"] = p.merchantID
+		}
+		if p.merchantName != "" {
+			properties["merchant"] = p.merchantName
+		}
+		collection.Features = append(collection.Features, models.GeoJSONFeature{
+			Type:       "Feature",
+			Geometry:   models.GeoJSONPoint{Type: "Point", Coordinates: []float64{p.longitude, p.latitude}},
+			Properties: properties,
+		})
+	}
+	return collection
+}
+
+type heatmapCell struct {
+	row, col int
+}
+
+// heatmapFeatures bins expenses into cells about cellSize metres square and
+// makes one feature per cell at its centre, with the cell's bounds as bbox.
+// Cells are rows of latitude, each divided into columns as wide in metres as
+// the row is high, so they do not stretch away from the equator.
+func heatmapFeatures(points []spendPoint, cellSize float64) models.GeoJSONFeatureCollection {
+	latStep := cellSize / place.MetresPerDegree
+	lngStep := func(row int) float64 {
+		cos := math.Cos((float64(row) + 0.5) * latStep * math.Pi / 180)
+		return cellSize / (place.MetresPerDegree * math.Max(cos, 0.01))
+	}
+
+	totals := map[heatmapCell]float64{}
+	counts := map[heatmapCell]int{}
+	for _, p := range points {
+		row := int(math.Floor(p.latitude / latStep))
+		cell := heatmapCell{row, int(math.Floor(p.longitude / lngStep(row)))}
+		totals[cell] += p.amount
+		counts[cell]++
+	}
+
+	cells := make([]heatmapCell, 0, len(totals))
+	for cell := range totals {
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if totals[cells[i]] != totals[cells[j]] {
+			return totals[cells[i]] > totals[cells[j]]
+		}
+		if cells[i].row != cells[j].row {
+			return cells[i].row < cells[j].row
+		}
+		return cells[i].col < cells[j].col
+	})
+
+	collection := models.GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []models.GeoJSONFeature{}}
+	for _, cell := range cells {
+		south := float64(cell.row) * latStep
+		west := float64(cell.col) * lngStep(cell.row)
+		north, east := south+latStep, west+lngStep(cell.row)
+		collection.Features = append(collection.Features, models.GeoJSONFeature{
+			Type:     "Feature",
+			BBox:     []float64{west, south, east, north},
+			Geometry: models.GeoJSONPoint{Type: "Point", Coordinates: []float64{(west + east) / 2, (south + north) / 2}},
+			Properties: map[string]interface{}{
+				"total":    math.Round(totals[cell]*100) / 100,
+				"count":    counts[cell],
+				"cellSize": cellSize,
+			},
+		})
+	}
+	return collection
+}
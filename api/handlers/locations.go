@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/config"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/geocode"
+	"github.com/sooraj1002/expense-tracker/location"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/place"
+)
+
+const locationColumns = "id, user_id, latitude, longitude, timestamp, address, accuracy, place_id, created_at"
+
+// scanLocation reads a row selected with locationColumns
+func scanLocation(row rowScanner) (models.Location, error) {
+	var l models.Location
+	var address sql.NullString
+	var accuracy sql.NullFloat64
+	err := row.Scan(&l.ID, &l.UserID, &l.Latitude, &l.Longitude, &l.Timestamp, &address, &accuracy, &l.PlaceID, &l.CreatedAt)
+	l.Address = address.String
+	l.Accuracy = accuracy.Float64
+	return l, err
+}
+
+// locationLimits returns the configured limits for linking expenses and transactions to fixes
+func locationLimits() location.Limits {
+	return location.Limits{
+		Window:      config.AppConfig.Location.LinkWindow,
+		MaxAccuracy: config.AppConfig.Location.MaxAccuracy,
+	}
+}
+
+// insertLocation saves a fix for the user with its address from the
+// gazetteer, if one is loaded. An accuracy of 0 is stored as unknown.
+func insertLocation(q dbExecutor, userID uuid.UUID, req models.CreateLocationRequest) (models.Location, error) {
+	var accuracy *float64
+	if req.Accuracy > 0 {
+		accuracy = &req.Accuracy
+	}
+	address := geocode.Default.Address(*req.Latitude, *req.Longitude)
+	return scanLocation(q.QueryRow(`
+		INSERT INTO locations (user_id, latitude, longitude, timestamp, address, accuracy, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+locationColumns,
+		userID, *req.Latitude, *req.Longitude, req.Timestamp, nullString(address), accuracy, time.Now(),
+	))
+}
+
+// CreateLocation stores a location fix, groups it into a place and links
+// expenses and transactions around that time that have no location yet
+func CreateLocation(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.CreateLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	response, ok := saveLocations(c, userID, []models.CreateLocationRequest{req})
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(response.Locations[0]))
+}
+
+// BatchCreateLocations stores many location fixes at once, as phones record
+// them in the background and upload them later
+func BatchCreateLocations(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.BatchLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	response, ok := saveLocations(c, userID, req.Locations)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(response))
+}
+
+// saveLocations stores the fixes in one transaction, groups the accurate ones
+// into places and links them to the expenses and transactions around them.
+// It writes the error response itself and reports whether it succeeded.
+func saveLocations(c *gin.Context, userID uuid.UUID, fixes []models.CreateLocationRequest) (models.BatchLocationResponse, bool) {
+	response := models.BatchLocationResponse{Locations: []models.Location{}}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to save locations"))
+		return response, false
+	}
+	defer tx.Rollback()
+
+	limits := locationLimits()
+	var from, to time.Time
+	for i, fix := range fixes {
+		l, err := insertLocation(tx, userID, fix)
+		if err != nil {
+			logger.Log.Errorw("Failed to save location", "error", err, "userId", userID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to save locations"))
+			return response, false
+		}
+		// Fixes too inaccurate to link to expenses would only smear places
+		if limits.MaxAccuracy == 0 || l.Accuracy <= limits.MaxAccuracy {
+			placeID, err := place.Assign(tx, userID, l.ID, place.Point{Latitude: l.Latitude, Longitude: l.Longitude}, config.AppConfig.Location.PlaceRadius, time.Now())
+			if err != nil {
+				logger.Log.Errorw("Failed to assign location to place", "error", err, "userId", userID)
+				c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to save locations"))
+				return response, false
+			}
+			l.PlaceID = &placeID
+		}
+		response.Locations = append(response.Locations, l)
+		if i == 0 || l.Timestamp.Before(from) {
+			from = l.Timestamp
+		}
+		if i == 0 || l.Timestamp.After(to) {
+			to = l.Timestamp
+		}
+	}
+	response.Created = len(response.Locations)
+
+	response.LinkedExpenses, response.LinkedTransactions, err = location.LinkUnlinked(tx, userID, from.Add(-limits.Window), to.Add(limits.Window), limits)
+	if err != nil {
+		logger.Log.Errorw("Failed to link locations", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to save locations"))
+		return response, false
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to save locations"))
+		return response, false
+	}
+
+	logger.Log.Infow("Locations saved", "created", response.Created, "linkedExpenses", response.LinkedExpenses,
+		"linkedTransactions", response.LinkedTransactions, "userId", userID)
+	return response, true
+}
+
+// GetLocationExpenses returns a location fix with the expenses linked to it
+func GetLocationExpenses(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	locationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid location ID"))
+		return
+	}
+
+	l, err := scanLocation(db.DB.QueryRow("SELECT "+locationColumns+" FROM locations WHERE id = $1 AND user_id = $2", locationID, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Location not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get location", "error", err, "locationId", locationID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get location expenses"))
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+expenseColumns+" FROM expenses WHERE location_id = $1 AND user_id = $2 ORDER BY date DESC", locationID, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get location expenses", "error", err, "locationId", locationID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get location expenses"))
+		return
+	}
+	defer rows.Close()
+
+	response := models.LocationExpensesResponse{Location: l, Expenses: []models.Expense{}}
+	for rows.Next() {
+		exp, err := scanExpense(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan expense", "error", err)
+			continue
+		}
+		response.Expenses = append(response.Expenses, exp)
+		response.TotalSpent += exp.Amount
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// MergeMerchant folds a merchant into another one, which keeps its name and gains its aliases and expenses
+func MergeMerchant(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	sourceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid merchant ID"))
+		return
+	}
+
+	var req models.MergeMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	if req.TargetID == sourceID {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Cannot merge a merchant into itself"))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to merge merchants"))
+		return
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM merchant_info WHERE user_id = $1 AND id IN ($2, $3)", userID, sourceID, req.TargetID).Scan(&count)
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchants", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to merge merchants"))
+		return
+	}
+	if count != 2 {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Merchant not found"))
+		return
+	}
+
+	expensesMoved, patternsRewritten, err := merchant.Merge(tx, userID, sourceID, req.TargetID)
+	if err != nil {
+		logger.Log.Errorw("Failed to merge merchants", "error", err, "sourceId", sourceID, "targetId", req.TargetID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to merge merchants"))
+		return
+	}
+
+	target, err := scanMerchant(tx.QueryRow("SELECT "+merchantColumns+" FROM merchant_info WHERE id = $1", req.TargetID))
+	if err != nil {
+		logger.Log.Errorw("Failed to get merged merchant", "error", err, "merchantId", req.TargetID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to merge merchants"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to merge merchants"))
+		return
+	}
+
+	if patternsRewritten > 0 {
+		matcher.Invalidate(userID)
+	}
+	logger.Log.Infow("Merchants merged", "sourceId", sourceID, "targetId", req.TargetID, "expensesMoved", expensesMoved, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(models.MergeMerchantResponse{
+		Merchant:          target,
+		ExpensesMoved:     expensesMoved,
+		PatternsRewritten: patternsRewritten,
+	}))
+}
+
+// SplitMerchant moves some of a merchant's aliases, and the expenses recorded under them, into a new merchant
+func SplitMerchant(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	sourceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid merchant ID"))
+		return
+	}
+
+	var req models.SplitMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Merchant name must not be empty"))
+		return
+	}
+	aliases := cleanAliases(req.Aliases)
+	if len(aliases) == 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "At least one alias must be moved"))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+	defer tx.Rollback()
+
+	source, err := scanMerchant(tx.QueryRow("SELECT "+merchantColumns+" FROM merchant_info WHERE id = $1 AND user_id = $2 FOR UPDATE", sourceID, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Merchant not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant", "error", err, "merchantId", sourceID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+
+	// The moved aliases must belong to the merchant, and none of them may
+	// normalise to the same name as something that stays behind, or new
+	// expenses would keep resolving to the old merchant
+	moving := map[string]bool{}
+	movingKeys := map[string]string{merchant.Normalize(name): name}
+	for _, alias := range aliases {
+		if !containsString(source.Aliases, alias) {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Merchant has no alias "+alias))
+			return
+		}
+		moving[alias] = true
+		movingKeys[merchant.Normalize(alias)] = alias
+	}
+	staying := []string{source.Name}
+	for _, alias := range source.Aliases {
+		if !moving[alias] {
+			staying = append(staying, alias)
+		}
+	}
+	for _, kept := range staying {
+		if moved, ok := movingKeys[merchant.Normalize(kept)]; ok {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, moved+" resolves to the same name as "+kept+", which stays with the merchant"))
+			return
+		}
+	}
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM merchant_info WHERE user_id = $1 AND name = $2)", userID, name).Scan(&exists)
+	if err != nil {
+		logger.Log.Errorw("Failed to check merchant name", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrCodeConflict, "A merchant with this name already exists"))
+		return
+	}
+
+	newID, expensesMoved, err := merchant.Split(tx, userID, sourceID, name, aliases)
+	if err != nil {
+		logger.Log.Errorw("Failed to split merchant", "error", err, "merchantId", sourceID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+
+	source, err = scanMerchant(tx.QueryRow("SELECT "+merchantColumns+" FROM merchant_info WHERE id = $1", sourceID))
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant", "error", err, "merchantId", sourceID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+	created, err := scanMerchant(tx.QueryRow("SELECT "+merchantColumns+" FROM merchant_info WHERE id = $1", newID))
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant", "error", err, "merchantId", newID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to split merchant"))
+		return
+	}
+
+	logger.Log.Infow("Merchant split", "merchantId", sourceID, "newMerchantId", newID, "expensesMoved", expensesMoved, "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(models.SplitMerchantResponse{
+		Merchant:      source,
+		NewMerchant:   created,
+		ExpensesMoved: expensesMoved,
+	}))
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+const merchantColumns = "id, user_id, name, aliases, common_category_id, transaction_count, total_spent, auto_created, created_at, updated_at"
+
+// GetMerchants retrieves the user's merchants, most used first
+func GetMerchants(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	search := strings.TrimSpace(c.Query("search"))
+	categoryIDStr := c.Query("categoryId")
+
+	query := "SELECT " + merchantColumns + " FROM merchant_info WHERE user_id = $1"
+	args := []interface{}{userID}
+	argCount := 1
+
+	if search != "" {
+		argCount++
+		query += " AND (name ILIKE $" + strconv.Itoa(argCount) +
+			" OR EXISTS (SELECT 1 FROM unnest(aliases) AS alias WHERE alias ILIKE $" + strconv.Itoa(argCount) + "))"
+		args = append(args, "%"+search+"%")
+	}
+	if categoryIDStr != "" {
+		if categoryID, err := uuid.Parse(categoryIDStr); err == nil {
+			argCount++
+			query += " AND common_category_id = $" + strconv.Itoa(argCount)
+			args = append(args, categoryID)
+		}
+	}
+	query += " ORDER BY transaction_count DESC, name ASC"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchants", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve merchants"))
+		return
+	}
+	defer rows.Close()
+
+	merchants := []models.MerchantInfo{}
+	for rows.Next() {
+		m, err := scanMerchant(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan merchant", "error", err)
+			continue
+		}
+		merchants = append(merchants, m)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(merchants))
+}
+
+// CreateMerchant creates a merchant, or replaces the aliases of an existing merchant with the same name.
+// Expenses and transactions whose raw names now resolve to it are moved onto it.
+func CreateMerchant(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.CreateMerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Merchant name must not be empty"))
+		return
+	}
+
+	// Leave the aliases of an existing merchant alone when none are given
+	var aliases pq.StringArray
+	if req.Aliases != nil {
+		aliases = cleanAliases(req.Aliases)
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create merchant"))
+		return
+	}
+	defer tx.Rollback()
+
+	var merchantID uuid.UUID
+	now := time.Now()
+	err = tx.QueryRow(`
+		INSERT INTO merchant_info (user_id, name, aliases, auto_created, created_at, updated_at)
+		VALUES ($1, $2, COALESCE($3, '{}'::TEXT[]), false, $4, $4)
+		ON CONFLICT (user_id, name) DO UPDATE
+		SET aliases = COALESCE($3, merchant_info.aliases), auto_created = false, updated_at = EXCLUDED.updated_at
+		RETURNING id
+	`, userID, name, aliases, now).Scan(&merchantID)
+	if err != nil {
+		logger.Log.Errorw("Failed to create merchant", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create merchant"))
+		return
+	}
+	if err := merchant.UpdateKeys(tx, merchantID); err != nil {
+		logger.Log.Errorw("Failed to update merchant keys", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create merchant"))
+		return
+	}
+
+	m, err := relinkMerchant(tx, userID, merchantID)
+	if err != nil {
+		logger.Log.Errorw("Failed to relink merchant", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create merchant"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create merchant"))
+		return
+	}
+
+	logger.Log.Infow("Merchant saved", "merchantId", m.ID, "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(m))
+}
+
+// AddMerchantAlias attaches a raw merchant name to a merchant, moving the expenses
+// and transactions recorded under that name onto it
+func AddMerchantAlias(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid merchant ID"))
+		return
+	}
+
+	var req models.AddMerchantAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	alias := strings.TrimSpace(req.Alias)
+	if merchant.Normalize(alias) == "" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Alias must contain letters or digits"))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM merchant_info WHERE id = $1 AND user_id = $2)", merchantID, userID).Scan(&exists)
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Merchant not found"))
+		return
+	}
+
+	// An alias may take names from auto-created merchants but not from curated ones
+	ownerID, err := merchant.Resolve(tx, userID, alias)
+	if err != nil {
+		logger.Log.Errorw("Failed to resolve merchant", "error", err, "alias", alias)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+	if ownerID != nil && *ownerID != merchantID {
+		var ownerName string
+		var autoCreated bool
+		err = tx.QueryRow("SELECT name, auto_created FROM merchant_info WHERE id = $1", *ownerID).Scan(&ownerName, &autoCreated)
+		if err != nil {
+			logger.Log.Errorw("Failed to get merchant", "error", err, "merchantId", *ownerID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+			return
+		}
+		if !autoCreated {
+			c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrCodeConflict, "Alias already resolves to merchant "+ownerName))
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE merchant_info
+		SET aliases = CASE WHEN $1 = ANY(aliases) THEN aliases ELSE array_append(COALESCE(aliases, '{}'::TEXT[]), $1) END,
+			auto_created = false, updated_at = $2
+		WHERE id = $3
+	`, alias, time.Now(), merchantID)
+	if err != nil {
+		logger.Log.Errorw("Failed to add merchant alias", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+	if err := merchant.UpdateKeys(tx, merchantID); err != nil {
+		logger.Log.Errorw("Failed to update merchant keys", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+
+	m, err := relinkMerchant(tx, userID, merchantID)
+	if err != nil {
+		logger.Log.Errorw("Failed to relink merchant", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to add merchant alias"))
+		return
+	}
+
+	logger.Log.Infow("Merchant alias added", "merchantId", merchantID, "alias", alias, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(m))
+}
+
+// GetUnresolvedMerchantNames lists raw merchant names that only resolve to
+// auto-created merchants, grouped by normalised name and ranked by frequency
+func GetUnresolvedMerchantNames(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	// Expenses linked to auto-created merchants, plus pending debits that have
+	// not become expenses yet and resolve to no merchant
+	rows, err := db.DB.Query(`
+		SELECT e.merchant_name, COUNT(*), MAX(e.date)
+		FROM expenses e
+		LEFT JOIN merchant_info m ON m.id = e.merchant_id
+		WHERE e.user_id = $1 AND e.merchant_name IS NOT NULL AND (m.id IS NULL OR m.auto_created)
+		GROUP BY e.merchant_name
+		UNION ALL
+		SELECT merchant_name, COUNT(*), MAX(timestamp)
+		FROM transactions
+		WHERE user_id = $1 AND merchant_name IS NOT NULL AND merchant_id IS NULL AND processed = false
+			AND COALESCE(direction, '') <> 'credit' AND (duplicate_of IS NULL OR duplicate_status = 'rejected')
+		GROUP BY merchant_name
+	`, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get unresolved merchant names", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get unresolved merchant names"))
+		return
+	}
+	defer rows.Close()
+
+	groups := map[string]*models.UnresolvedMerchantName{}
+	for rows.Next() {
+		var rawName string
+		var count int
+		var lastSeen time.Time
+		if err := rows.Scan(&rawName, &count, &lastSeen); err != nil {
+			logger.Log.Errorw("Failed to scan unresolved merchant name", "error", err)
+			continue
+		}
+
+		key := merchant.Normalize(rawName)
+		if key == "" {
+			continue
+		}
+		group := groups[key]
+		if group == nil {
+			group = &models.UnresolvedMerchantName{Name: key, RawNames: []string{}}
+			groups[key] = group
+		}
+		if !containsString(group.RawNames, rawName) {
+			group.RawNames = append(group.RawNames, rawName)
+		}
+		group.Count += count
+		if lastSeen.After(group.LastSeen) {
+			group.LastSeen = lastSeen
+		}
+	}
+
+	unresolved := make([]models.UnresolvedMerchantName, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.RawNames)
+		unresolved = append(unresolved, *group)
+	}
+	sort.Slice(unresolved, func(i, j int) bool {
+		if unresolved[i].Count != unresolved[j].Count {
+			return unresolved[i].Count > unresolved[j].Count
+		}
+		return unresolved[i].LastSeen.After(unresolved[j].LastSeen)
+	})
+	if len(unresolved) > limit {
+		unresolved = unresolved[:limit]
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(unresolved))
+}
+
+// GetMerchantExpenses retrieves the expenses linked to a merchant with pagination
+func GetMerchantExpenses(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	merchantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid merchant ID"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	m, err := scanMerchant(db.DB.QueryRow("SELECT "+merchantColumns+" FROM merchant_info WHERE id = $1 AND user_id = $2", merchantID, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Merchant not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get merchant expenses"))
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+expenseColumns+" FROM expenses WHERE merchant_id = $1 AND user_id = $2 ORDER BY date DESC LIMIT $3 OFFSET $4",
+		merchantID, userID, limit, offset)
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant expenses", "error", err, "merchantId", merchantID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get merchant expenses"))
+		return
+	}
+	defer rows.Close()
+
+	expenses := []models.Expense{}
+	for rows.Next() {
+		exp, err := scanExpense(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan expense", "error", err)
+			continue
+		}
+		expenses = append(expenses, exp)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(models.MerchantExpensesResponse{
+		Merchant:     m,
+		Expenses:     expenses,
+		TotalSpent:   m.TotalSpent,
+		ExpenseCount: m.TransactionCount,
+	}))
+}
+
+// relinkMerchant moves matching expenses and transactions onto the merchant and returns it with fresh counters
+func relinkMerchant(tx *sql.Tx, userID, merchantID uuid.UUID) (models.MerchantInfo, error) {
+	if err := merchant.Relink(tx, userID, merchantID); err != nil {
+		return models.MerchantInfo{}, err
+	}
+	return scanMerchant(tx.QueryRow("SELECT "+merchantColumns+" FROM merchant_info WHERE id = $1", merchantID))
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanAliases trims aliases and drops empty and repeated ones
+func cleanAliases(aliases []string) pq.StringArray {
+	cleaned := pq.StringArray{}
+	seen := map[string]bool{}
+	for _, alias := range aliases {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		cleaned = append(cleaned, alias)
+	}
+	return cleaned
+}
+
+// scanMerchant reads a row selected with merchantColumns
+func scanMerchant(row rowScanner) (models.MerchantInfo, error) {
+	var m models.MerchantInfo
+	var transactionCount sql.NullInt64
+	var totalSpent sql.NullFloat64
+	err := row.Scan(&m.ID, &m.UserID, &m.Name, &m.Aliases, &m.CommonCategoryID, &transactionCount, &totalSpent, &m.AutoCreated, &m.CreatedAt, &m.UpdatedAt)
+	if m.Aliases == nil {
+		m.Aliases = pq.StringArray{}
+	}
+	m.TransactionCount = int(transactionCount.Int64)
+	m.TotalSpent = totalSpent.Float64
+	return m, err
+}
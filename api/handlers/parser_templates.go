@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/parser"
+)
+
+const parserTemplateColumns = "id, user_id, name, sender_match, pattern, direction, priority, is_active, created_at, updated_at"
+
+// userTemplatePrefix marks user templates in transactions.parse_template
+const userTemplatePrefix = "user:"
+
+// GetParserTemplates retrieves all parser templates for the user
+func GetParserTemplates(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+parserTemplateColumns+" FROM parser_templates WHERE user_id = $1 ORDER BY priority DESC, created_at ASC", userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get parser templates", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve parser templates"))
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.ParserTemplate{}
+	for rows.Next() {
+		t, err := scanParserTemplate(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan parser template", "error", err)
+			continue
+		}
+		templates = append(templates, t)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(templates))
+}
+
+// CreateParserTemplate creates a new parser template after validating its pattern
+func CreateParserTemplate(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.CreateParserTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	if _, err := parser.NewTemplate(req.Name, req.SenderMatch, req.Pattern, req.Direction); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	var exists bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM parser_templates WHERE user_id = $1 AND name = $2)", userID, req.Name).Scan(&exists)
+	if err == nil && exists {
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrCodeConflict, "Parser template with this name already exists"))
+		return
+	}
+
+	now := time.Now()
+	template, err := scanParserTemplate(db.DB.QueryRow(`
+		INSERT INTO parser_templates (user_id, name, sender_match, pattern, direction, priority, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+parserTemplateColumns,
+		userID, req.Name, nullString(req.SenderMatch), req.Pattern, req.Direction, req.Priority, true, now, now,
+	))
+	if err != nil {
+		logger.Log.Errorw("Failed to create parser template", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create parser template"))
+		return
+	}
+
+	logger.Log.Infow("Parser template created", "templateId", template.ID, "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(template))
+}
+
+// UpdateParserTemplate updates a parser template, re-validating the pattern if it changed
+func UpdateParserTemplate(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid parser template ID"))
+		return
+	}
+
+	var req models.UpdateParserTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	existing, err := scanParserTemplate(db.DB.QueryRow("SELECT "+parserTemplateColumns+" FROM parser_templates WHERE id = $1", templateID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Parser template not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get parser template", "error", err, "templateId", templateID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update parser template"))
+		return
+	}
+	if existing.UserID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "Permission denied"))
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	argCount := 0
+
+	if req.Name != nil {
+		argCount++
+		updates = append(updates, "name = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Name)
+		existing.Name = *req.Name
+	}
+	if req.SenderMatch != nil {
+		argCount++
+		updates = append(updates, "sender_match = $"+strconv.Itoa(argCount))
+		args = append(args, nullString(*req.SenderMatch))
+		existing.SenderMatch = *req.SenderMatch
+	}
+	if req.Pattern != nil {
+		argCount++
+		updates = append(updates, "pattern = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Pattern)
+		existing.Pattern = *req.Pattern
+	}
+	if req.Direction != nil {
+		argCount++
+		updates = append(updates, "direction = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Direction)
+		existing.Direction = *req.Direction
+	}
+	if req.Priority != nil {
+		argCount++
+		updates = append(updates, "priority = $"+strconv.Itoa(argCount))
+		args = append(args, *req.Priority)
+	}
+	if req.IsActive != nil {
+		argCount++
+		updates = append(updates, "is_active = $"+strconv.Itoa(argCount))
+		args = append(args, *req.IsActive)
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "No fields to update"))
+		return
+	}
+
+	if _, err := parser.NewTemplate(existing.Name, existing.SenderMatch, existing.Pattern, existing.Direction); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	if req.Name != nil {
+		var exists bool
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM parser_templates WHERE user_id = $1 AND name = $2 AND id <> $3)", userID, *req.Name, templateID).Scan(&exists)
+		if err == nil && exists {
+			c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrCodeConflict, "Parser template with this name already exists"))
+			return
+		}
+	}
+
+	argCount++
+	updates = append(updates, "updated_at = $"+strconv.Itoa(argCount))
+	args = append(args, time.Now())
+
+	argCount++
+	args = append(args, templateID)
+
+	query := "UPDATE parser_templates SET " + updates[0]
+	for i := 1; i < len(updates); i++ {
+		query += ", " + updates[i]
+	}
+	query += " WHERE id = $" + strconv.Itoa(argCount) + " RETURNING " + parserTemplateColumns
+
+	template, err := scanParserTemplate(db.DB.QueryRow(query, args...))
+	if err != nil {
+		logger.Log.Errorw("Failed to update parser template", "error", err, "templateId", templateID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update parser template"))
+		return
+	}
+
+	logger.Log.Infow("Parser template updated", "templateId", templateID, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(template))
+}
+
+// DeleteParserTemplate deletes a parser template
+func DeleteParserTemplate(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid parser template ID"))
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = db.DB.QueryRow("SELECT user_id FROM parser_templates WHERE id = $1", templateID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Parser template not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get parser template", "error", err, "templateId", templateID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete parser template"))
+		return
+	}
+	if ownerID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "Permission denied"))
+		return
+	}
+
+	_, err = db.DB.Exec("DELETE FROM parser_templates WHERE id = $1", templateID)
+	if err != nil {
+		logger.Log.Errorw("Failed to delete parser template", "error", err, "templateId", templateID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete parser template"))
+		return
+	}
+
+	logger.Log.Infow("Parser template deleted", "templateId", templateID, "userId", userID)
+	c.Status(http.StatusNoContent)
+}
+
+// TestParserTemplate runs a stored or unsaved template against sample text and returns the extracted fields
+func TestParserTemplate(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.TestParserTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	name, senderMatch, pattern, direction := "test", req.SenderMatch, req.Pattern, req.Direction
+	if req.TemplateID != nil {
+		stored, err := scanParserTemplate(db.DB.QueryRow("SELECT "+parserTemplateColumns+" FROM parser_templates WHERE id = $1", *req.TemplateID))
+		if err == sql.ErrNoRows || (err == nil && stored.UserID != userID) {
+			c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Parser template not found"))
+			return
+		}
+		if err != nil {
+			logger.Log.Errorw("Failed to get parser template", "error", err, "templateId", *req.TemplateID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to test parser template"))
+			return
+		}
+		name, senderMatch, pattern, direction = stored.Name, stored.SenderMatch, stored.Pattern, stored.Direction
+	} else if pattern == "" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Either templateId or pattern is required"))
+		return
+	}
+	if direction == "" {
+		direction = parser.DirectionDebit
+	}
+
+	template, err := parser.NewTemplate(name, senderMatch, pattern, direction)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	result := template.Apply(req.RawText)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(models.TestParserTemplateResponse{
+		Matched:       result != nil,
+		SenderMatched: template.MatchesSender(req.SenderInfo),
+		Result:        result,
+	}))
+}
+
+// loadUserTemplates returns the user's active parser templates, compiled and in priority order.
+// Templates that no longer compile are skipped.
+func loadUserTemplates(q dbExecutor, userID uuid.UUID) ([]*parser.Template, error) {
+	rows, err := q.Query("SELECT "+parserTemplateColumns+" FROM parser_templates WHERE user_id = $1 AND is_active = true ORDER BY priority DESC, created_at ASC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*parser.Template{}
+	for rows.Next() {
+		t, err := scanParserTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := parser.NewTemplate(userTemplatePrefix+t.Name, t.SenderMatch, t.Pattern, t.Direction)
+		if err != nil {
+			logger.Log.Warnw("Skipping invalid parser template", "error", err, "templateId", t.ID)
+			continue
+		}
+		templates = append(templates, compiled)
+	}
+
+	return templates, rows.Err()
+}
+
+// scanParserTemplate reads a row selected with parserTemplateColumns
+func scanParserTemplate(row rowScanner) (models.ParserTemplate, error) {
+	var t models.ParserTemplate
+	var senderMatch sql.NullString
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &senderMatch, &t.Pattern, &t.Direction, &t.Priority, &t.IsActive, &t.CreatedAt, &t.UpdatedAt)
+	t.SenderMatch = senderMatch.String
+	return t, err
+}
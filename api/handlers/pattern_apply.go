@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// ApplyMerchantPattern recategorises existing expenses the pattern matches. By
+// default it only previews the changes; with dryRun false it makes them in one
+// transaction. Expenses that another pattern takes precedence for are left alone.
+func ApplyMerchantPattern(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	patternID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid pattern ID"))
+		return
+	}
+
+	// An empty body is a dry run over all expenses
+	var req models.ApplyPatternRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+	dryRun := req.DryRun == nil || *req.DryRun
+
+	var pattern models.MerchantPattern
+	err = db.DB.QueryRow("SELECT id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at FROM merchant_patterns WHERE id = $1 AND user_id = $2", patternID, userID).Scan(
+		&pattern.ID, &pattern.UserID, &pattern.MerchantName, &pattern.CategoryID, &pattern.MatchType, &pattern.Priority, &pattern.FuzzyThreshold, &pattern.IsActive, &pattern.UseCount, &pattern.LastUsedAt, &pattern.CreatedAt, &pattern.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Pattern not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get pattern", "error", err, "patternId", patternID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+	if !pattern.IsActive {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Pattern is not active"))
+		return
+	}
+
+	where := "user_id = $1 AND category_id <> $2 AND merchant_name IS NOT NULL AND merchant_name <> ''"
+	args := []interface{}{userID, pattern.CategoryID}
+	argCount := 2
+
+	if req.UnverifiedOnly {
+		where += " AND verified = false"
+	}
+	if req.StartDate != "" {
+		start, err := parseDateParam(req.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid startDate"))
+			return
+		}
+		argCount++
+		where += " AND date >= $" + strconv.Itoa(argCount)
+		args = append(args, start)
+	}
+	if req.EndDate != "" {
+		end, err := parseDateParam(req.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid endDate"))
+			return
+		}
+		// A bare date includes the whole day
+		if !strings.Contains(req.EndDate, "T") {
+			end = end.AddDate(0, 0, 1)
+		}
+		argCount++
+		where += " AND date < $" + strconv.Itoa(argCount)
+		args = append(args, end)
+	}
+
+	compiled, err := matcher.ForUser(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+	single := matcher.Compile([]models.MerchantPattern{pattern})
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+	defer tx.Rollback()
+
+	query := "SELECT id, merchant_id, merchant_name, amount, date, verified, category_id FROM expenses WHERE " + where + " ORDER BY date DESC"
+	if !dryRun {
+		query += " FOR UPDATE"
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		logger.Log.Errorw("Failed to get expenses", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+
+	response := models.ApplyPatternResponse{
+		DryRun:  dryRun,
+		Changes: []models.PatternApplyChange{},
+	}
+	expenseIDs := []string{}
+	merchantIDs := []*uuid.UUID{}
+	for rows.Next() {
+		var change models.PatternApplyChange
+		var merchantID *uuid.UUID
+		err := rows.Scan(&change.ExpenseID, &merchantID, &change.MerchantName, &change.Amount, &change.Date, &change.Verified, &change.FromCategoryID)
+		if err != nil {
+			rows.Close()
+			logger.Log.Errorw("Failed to scan expense", "error", err)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+			return
+		}
+		if single.Match(change.MerchantName) == nil {
+			continue
+		}
+		if winner := compiled.Match(change.MerchantName); winner != nil && winner.ID != pattern.ID {
+			response.Shadowed++
+			continue
+		}
+		change.ToCategoryID = pattern.CategoryID
+		response.Changes = append(response.Changes, change)
+		expenseIDs = append(expenseIDs, change.ExpenseID.String())
+		merchantIDs = append(merchantIDs, merchantID)
+	}
+	rows.Close()
+
+	if dryRun || len(expenseIDs) == 0 {
+		c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+		return
+	}
+
+	result, err := tx.Exec("UPDATE expenses SET category_id = $1, updated_at = $2 WHERE id = ANY($3::uuid[])", pattern.CategoryID, time.Now(), pq.Array(expenseIDs))
+	if err != nil {
+		logger.Log.Errorw("Failed to recategorise expenses", "error", err, "patternId", patternID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+	updated, _ := result.RowsAffected()
+	response.Updated = int(updated)
+
+	// The most common category of each merchant may have changed
+	if err := merchant.Refresh(tx, merchantIDs...); err != nil {
+		logger.Log.Errorw("Failed to refresh merchants", "error", err, "patternId", patternID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to apply pattern"))
+		return
+	}
+
+	logger.Log.Infow("Pattern applied", "patternId", patternID, "updated", response.Updated, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/patternpack"
+)
+
+// maxImportPatterns caps the number of patterns in one imported pack
+const maxImportPatterns = 1000
+
+// maxRenameAttempts caps the names tried for a renamed import
+const maxRenameAttempts = 10
+
+// ExportMerchantPatterns downloads all of the user's patterns as a pattern pack, in JSON or CSV
+func ExportMerchantPatterns(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "format must be json or csv"))
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT p.merchant_name, p.match_type, c.name, p.priority, p.fuzzy_threshold, p.is_active
+		FROM merchant_patterns p
+		JOIN categories c ON c.id = p.category_id
+		WHERE p.user_id = $1
+		ORDER BY p.priority DESC, p.created_at ASC, p.id ASC
+	`, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to export patterns"))
+		return
+	}
+	defer rows.Close()
+
+	pack := models.PatternPack{
+		Version:    patternpack.Version,
+		ExportedAt: time.Now(),
+		Patterns:   []models.PatternPackEntry{},
+	}
+	for rows.Next() {
+		var entry models.PatternPackEntry
+		var isActive bool
+		if err := rows.Scan(&entry.MerchantName, &entry.MatchType, &entry.Category, &entry.Priority, &entry.FuzzyThreshold, &isActive); err != nil {
+			logger.Log.Errorw("Failed to scan pattern", "error", err)
+			continue
+		}
+		entry.IsActive = &isActive
+		pack.Patterns = append(pack.Patterns, entry)
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="merchant-patterns.`+format+`"`)
+	if format == "json" {
+		c.JSON(http.StatusOK, pack)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := patternpack.WriteCSV(&buf, pack); err != nil {
+		logger.Log.Errorw("Failed to write pattern pack", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeInternalError, "Failed to export patterns"))
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// ImportMerchantPatterns creates patterns from a pattern pack sent as JSON or,
+// with a text/csv content type, as CSV. Categories are matched by name to the
+// user's own expense categories first, then the defaults. The conflict query
+// parameter decides what happens to names the user already has a pattern for.
+func ImportMerchantPatterns(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	conflict := c.DefaultQuery("conflict", models.ImportConflictSkip)
+	if conflict != models.ImportConflictSkip && conflict != models.ImportConflictOverwrite && conflict != models.ImportConflictRename {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "conflict must be skip, overwrite or rename"))
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+
+	var pack models.PatternPack
+	if c.ContentType() == "text/csv" {
+		pack, err = patternpack.ReadCSV(c.Request.Body)
+	} else {
+		pack, err = patternpack.ReadJSON(c.Request.Body)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+	if len(pack.Patterns) > maxImportPatterns {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "A pack can hold at most 1000 patterns"))
+		return
+	}
+
+	categories, err := expenseCategoriesByName(userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get categories", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to import patterns"))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to import patterns"))
+		return
+	}
+	defer tx.Rollback()
+
+	response := models.ImportPatternsResponse{
+		DryRun:   dryRun,
+		Conflict: conflict,
+		Results:  []models.PatternImportResult{},
+	}
+	now := time.Now()
+	for i, entry := range pack.Patterns {
+		// Stagger creation times so the pack order still breaks final ties between patterns
+		created := now.Add(time.Duration(i) * time.Microsecond)
+		result := models.PatternImportResult{MerchantName: entry.MerchantName}
+		name := strings.TrimSpace(entry.MerchantName)
+		matchType := entry.MatchType
+		if matchType == "" {
+			matchType = models.MatchTypeContains
+		}
+		isActive := entry.IsActive == nil || *entry.IsActive
+
+		categoryID, ok := categories[strings.ToLower(strings.TrimSpace(entry.Category))]
+		if err := validatePackEntry(matchType, name, entry.FuzzyThreshold); err != nil {
+			result.Status, result.Error = models.ImportStatusInvalid, err.Error()
+		} else if !ok {
+			result.Status, result.Error = models.ImportStatusInvalid, "unknown category "+entry.Category
+		}
+		if result.Status == models.ImportStatusInvalid {
+			response.Invalid++
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		var existingID uuid.UUID
+		err := tx.QueryRow("SELECT id FROM merchant_patterns WHERE user_id = $1 AND merchant_name = $2", userID, name).Scan(&existingID)
+		if err != nil && err != sql.ErrNoRows {
+			logger.Log.Errorw("Failed to check pattern", "error", err, "merchantName", name)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to import patterns"))
+			return
+		}
+
+		importAs := name
+		result.Status = models.ImportStatusCreated
+		if err == nil {
+			result.ExistingPatternID = &existingID
+			switch conflict {
+			case models.ImportConflictSkip:
+				result.Status = models.ImportStatusSkipped
+			case models.ImportConflictOverwrite:
+				result.Status = models.ImportStatusUpdated
+			case models.ImportConflictRename:
+				importAs, err = freePatternName(tx, userID, name)
+				if err != nil {
+					logger.Log.Errorw("Failed to check pattern", "error", err, "merchantName", name)
+					c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to import patterns"))
+					return
+				}
+				// The renamed pattern would compete with the existing one for the same
+				// merchants, so it stays inactive until the user reviews it
+				result.Status, isActive = models.ImportStatusRenamed, false
+				if importAs == "" {
+					result.Status, result.Error = models.ImportStatusSkipped, "no free name to rename to"
+				}
+			}
+		}
+
+		var patternID uuid.UUID
+		switch result.Status {
+		case models.ImportStatusCreated, models.ImportStatusRenamed:
+			err = tx.QueryRow(`
+				INSERT INTO merchant_patterns (user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				RETURNING id
+			`, userID, importAs, categoryID, matchType, entry.Priority, entry.FuzzyThreshold, isActive, 0, created, created).Scan(&patternID)
+		case models.ImportStatusUpdated:
+			patternID = existingID
+			_, err = tx.Exec(`
+				UPDATE merchant_patterns
+				SET category_id = $1, match_type = $2, priority = $3, fuzzy_threshold = $4, is_active = $5, updated_at = $6
+				WHERE id = $7
+			`, categoryID, matchType, entry.Priority, entry.FuzzyThreshold, isActive, now, existingID)
+		}
+		if err != nil {
+			logger.Log.Errorw("Failed to import pattern", "error", err, "merchantName", name)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to import patterns"))
+			return
+		}
+
+		switch result.Status {
+		case models.ImportStatusCreated:
+			response.Created++
+		case models.ImportStatusUpdated:
+			response.Updated++
+		case models.ImportStatusRenamed:
+			response.Renamed++
+			result.ImportedAs = importAs
+		case models.ImportStatusSkipped:
+			response.Skipped++
+		}
+		if patternID != uuid.Nil && !dryRun {
+			result.PatternID = &patternID
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to import patterns"))
+		return
+	}
+
+	matcher.Invalidate(userID)
+	logger.Log.Infow("Patterns imported", "created", response.Created, "updated", response.Updated, "renamed", response.Renamed, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+}
+
+// validatePackEntry checks the match type, pattern and threshold of an imported entry
+func validatePackEntry(matchType, name string, threshold *float64) error {
+	switch matchType {
+	case models.MatchTypeExact, models.MatchTypeContains, models.MatchTypeStartsWith, models.MatchTypeEndsWith, models.MatchTypeWord, models.MatchTypeRegex, models.MatchTypeFuzzy:
+	default:
+		return errors.New("matchType must be exact, contains, starts_with, ends_with, word, regex or fuzzy")
+	}
+	if err := matcher.ValidateThreshold(matchType, threshold); err != nil {
+		return err
+	}
+	return matcher.Validate(matchType, name)
+}
+
+// expenseCategoriesByName maps lower-cased category names to the expense
+// categories the user can use, with the user's own taking precedence over the defaults
+func expenseCategoriesByName(userID uuid.UUID) (map[string]uuid.UUID, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, name FROM categories
+		WHERE (user_id IS NULL OR user_id = $1) AND type = $2
+		ORDER BY user_id NULLS FIRST
+	`, userID, models.CategoryTypeExpense)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := map[string]uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		categories[strings.ToLower(strings.TrimSpace(name))] = id
+	}
+	return categories, rows.Err()
+}
+
+// freePatternName finds a name for an imported pattern whose name is taken
+// already: the name followed by " (imported)", numbered from 2 if that is taken
+// too. It returns "" if every candidate is taken.
+func freePatternName(tx *sql.Tx, userID uuid.UUID, name string) (string, error) {
+	for i := 1; i <= maxRenameAttempts; i++ {
+		candidate := name + " (imported)"
+		if i > 1 {
+			candidate = name + " (imported " + strconv.Itoa(i) + ")"
+		}
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM merchant_patterns WHERE user_id = $1 AND merchant_name = $2)", userID, candidate).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
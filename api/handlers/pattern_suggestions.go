@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// GetMerchantPatternSuggestions proposes patterns for merchant names that the
+// user's verified expenses consistently put in one category
+func GetMerchantPatternSuggestions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	minSupport := 3
+	if v := c.Query("minSupport"); v != "" {
+		minSupport, err = strconv.Atoi(v)
+		if err != nil || minSupport < 2 {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "minSupport must be a number of at least 2"))
+			return
+		}
+	}
+	minConfidence := 0.8
+	if v := c.Query("minConfidence"); v != "" {
+		minConfidence, err = strconv.ParseFloat(v, 64)
+		if err != nil || minConfidence <= 0.5 || minConfidence > 1 {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "minConfidence must be above 0.5 and at most 1"))
+			return
+		}
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT merchant_name, category_id
+		FROM expenses
+		WHERE user_id = $1 AND verified = true AND merchant_name IS NOT NULL AND merchant_name <> ''
+	`, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get verified expenses", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get pattern suggestions"))
+		return
+	}
+	samples := []matcher.Sample{}
+	for rows.Next() {
+		var s matcher.Sample
+		if err := rows.Scan(&s.MerchantName, &s.CategoryID); err != nil {
+			logger.Log.Errorw("Failed to scan expense", "error", err)
+			continue
+		}
+		samples = append(samples, s)
+	}
+	rows.Close()
+
+	// Inactive patterns count too, so a pattern the user switched off is not proposed again
+	taken := map[string]bool{}
+	rows, err = db.DB.Query("SELECT merchant_name FROM merchant_patterns WHERE user_id = $1", userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get pattern suggestions"))
+		return
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			logger.Log.Errorw("Failed to scan pattern", "error", err)
+			continue
+		}
+		taken[strings.ToLower(name)] = true
+	}
+	rows.Close()
+
+	compiled, err := matcher.ForUser(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get pattern suggestions"))
+		return
+	}
+
+	suggestions := matcher.Suggest(samples, compiled, taken, minSupport, minConfidence)
+
+	categoryNames := map[uuid.UUID]string{}
+	rows, err = db.DB.Query("SELECT id, name FROM categories WHERE user_id IS NULL OR user_id = $1", userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get categories", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get pattern suggestions"))
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			logger.Log.Errorw("Failed to scan category", "error", err)
+			continue
+		}
+		categoryNames[id] = name
+	}
+	for i := range suggestions {
+		suggestions[i].CategoryName = categoryNames[suggestions[i].CategoryID]
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(suggestions))
+}
+
+// AcceptMerchantPatternSuggestions creates patterns for a batch of accepted
+// suggestions. Names that already have a pattern are skipped rather than failing the batch.
+func AcceptMerchantPatternSuggestions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.AcceptPatternSuggestionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	for _, s := range req.Suggestions {
+		if err := matcher.Validate(s.MatchType, s.MerchantName); err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, s.MerchantName+": "+err.Error()))
+			return
+		}
+		if err := matcher.ValidateThreshold(s.MatchType, s.FuzzyThreshold); err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, s.MerchantName+": "+err.Error()))
+			return
+		}
+		if !checkCategoryType(c, userID, s.CategoryID, models.CategoryTypeExpense, "Failed to accept suggestions") {
+			return
+		}
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to accept suggestions"))
+		return
+	}
+	defer tx.Rollback()
+
+	response := models.AcceptPatternSuggestionsResponse{
+		Created: []models.MerchantPattern{},
+		Skipped: []string{},
+	}
+	now := time.Now()
+	for _, s := range req.Suggestions {
+		var pattern models.MerchantPattern
+		err = tx.QueryRow(`
+			INSERT INTO merchant_patterns (user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (user_id, merchant_name) DO NOTHING
+			RETURNING id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at
+		`, userID, s.MerchantName, s.CategoryID, s.MatchType, s.Priority, s.FuzzyThreshold, true, 0, now, now).Scan(
+			&pattern.ID, &pattern.UserID, &pattern.MerchantName, &pattern.CategoryID, &pattern.MatchType, &pattern.Priority, &pattern.FuzzyThreshold, &pattern.IsActive, &pattern.UseCount, &pattern.LastUsedAt, &pattern.CreatedAt, &pattern.UpdatedAt,
+		)
+		if err == sql.ErrNoRows {
+			response.Skipped = append(response.Skipped, s.MerchantName)
+			continue
+		}
+		if err != nil {
+			logger.Log.Errorw("Failed to create pattern", "error", err, "merchantName", s.MerchantName)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to accept suggestions"))
+			return
+		}
+		response.Created = append(response.Created, pattern)
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to accept suggestions"))
+		return
+	}
+
+	matcher.Invalidate(userID)
+	logger.Log.Infow("Pattern suggestions accepted", "created", len(response.Created), "skipped", len(response.Skipped), "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(response))
+}
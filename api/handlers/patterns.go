@@ -3,7 +3,8 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
-	"strings"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,6 +12,7 @@ import (
 	"github.com/sooraj1002/expense-tracker/api/middleware"
 	"github.com/sooraj1002/expense-tracker/db"
 	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
 	"github.com/sooraj1002/expense-tracker/models"
 )
 
@@ -23,7 +25,7 @@ func GetMerchantPatterns(c *gin.Context) {
 	}
 
 	isActive := c.Query("isActive")
-	query := `SELECT id, user_id, merchant_name, category_id, match_type, is_active, use_count, last_used_at, created_at, updated_at
+	query := `SELECT id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at
 		FROM merchant_patterns WHERE user_id = $1`
 	args := []interface{}{userID}
 
@@ -45,7 +47,7 @@ func GetMerchantPatterns(c *gin.Context) {
 	patterns := []models.MerchantPattern{}
 	for rows.Next() {
 		var p models.MerchantPattern
-		err := rows.Scan(&p.ID, &p.UserID, &p.MerchantName, &p.CategoryID, &p.MatchType, &p.IsActive, &p.UseCount, &p.LastUsedAt, &p.CreatedAt, &p.UpdatedAt)
+		err := rows.Scan(&p.ID, &p.UserID, &p.MerchantName, &p.CategoryID, &p.MatchType, &p.Priority, &p.FuzzyThreshold, &p.IsActive, &p.UseCount, &p.LastUsedAt, &p.CreatedAt, &p.UpdatedAt)
 		if err == nil {
 			patterns = append(patterns, p)
 		}
@@ -68,6 +70,18 @@ func CreateMerchantPattern(c *gin.Context) {
 		return
 	}
 
+	if err := matcher.Validate(req.MatchType, req.MerchantName); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+	if err := matcher.ValidateThreshold(req.MatchType, req.FuzzyThreshold); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+	if ok := checkCategoryType(c, userID, req.CategoryID, models.CategoryTypeExpense, "Failed to create pattern"); !ok {
+		return
+	}
+
 	// Check for existing pattern
 	var exists bool
 	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM merchant_patterns WHERE user_id = $1 AND merchant_name = $2)", userID, req.MerchantName).Scan(&exists)
@@ -79,11 +93,11 @@ func CreateMerchantPattern(c *gin.Context) {
 	var pattern models.MerchantPattern
 	now := time.Now()
 	err = db.DB.QueryRow(`
-		INSERT INTO merchant_patterns (user_id, merchant_name, category_id, match_type, is_active, use_count, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, user_id, merchant_name, category_id, match_type, is_active, use_count, last_used_at, created_at, updated_at
-	`, userID, req.MerchantName, req.CategoryID, req.MatchType, true, 0, now, now).Scan(
-		&pattern.ID, &pattern.UserID, &pattern.MerchantName, &pattern.CategoryID, &pattern.MatchType, &pattern.IsActive, &pattern.UseCount, &pattern.LastUsedAt, &pattern.CreatedAt, &pattern.UpdatedAt,
+		INSERT INTO merchant_patterns (user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at
+	`, userID, req.MerchantName, req.CategoryID, req.MatchType, req.Priority, req.FuzzyThreshold, true, 0, now, now).Scan(
+		&pattern.ID, &pattern.UserID, &pattern.MerchantName, &pattern.CategoryID, &pattern.MatchType, &pattern.Priority, &pattern.FuzzyThreshold, &pattern.IsActive, &pattern.UseCount, &pattern.LastUsedAt, &pattern.CreatedAt, &pattern.UpdatedAt,
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to create pattern", "error", err)
@@ -91,6 +105,7 @@ func CreateMerchantPattern(c *gin.Context) {
 		return
 	}
 
+	matcher.Invalidate(userID)
 	logger.Log.Infow("Pattern created", "patternId", pattern.ID, "userId", userID)
 	c.JSON(http.StatusCreated, models.NewSuccessResponse(pattern))
 }
@@ -117,7 +132,8 @@ func UpdateMerchantPattern(c *gin.Context) {
 
 	// Check ownership
 	var ownerID uuid.UUID
-	err = db.DB.QueryRow("SELECT user_id FROM merchant_patterns WHERE id = $1", patternID).Scan(&ownerID)
+	var merchantName, matchType string
+	err = db.DB.QueryRow("SELECT user_id, merchant_name, match_type FROM merchant_patterns WHERE id = $1", patternID).Scan(&ownerID, &merchantName, &matchType)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Pattern not found"))
 		return
@@ -127,6 +143,23 @@ func UpdateMerchantPattern(c *gin.Context) {
 		return
 	}
 
+	if req.MatchType != nil {
+		if err := matcher.Validate(*req.MatchType, merchantName); err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+			return
+		}
+		matchType = *req.MatchType
+	}
+	if err := matcher.ValidateThreshold(matchType, req.FuzzyThreshold); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+	if req.CategoryID != nil {
+		if ok := checkCategoryType(c, userID, *req.CategoryID, models.CategoryTypeExpense, "Failed to update pattern"); !ok {
+			return
+		}
+	}
+
 	// Build update
 	updates := "updated_at = $1"
 	args := []interface{}{time.Now()}
@@ -141,12 +174,26 @@ func UpdateMerchantPattern(c *gin.Context) {
 		argCount++
 		updates += ", match_type = $" + string(rune(argCount+'0'))
 		args = append(args, *req.MatchType)
+		// A threshold means nothing to other match types
+		if *req.MatchType != models.MatchTypeFuzzy {
+			updates += ", fuzzy_threshold = NULL"
+		}
+	}
+	if req.FuzzyThreshold != nil {
+		argCount++
+		updates += ", fuzzy_threshold = $" + string(rune(argCount+'0'))
+		args = append(args, *req.FuzzyThreshold)
 	}
 	if req.IsActive != nil {
 		argCount++
 		updates += ", is_active = $" + string(rune(argCount+'0'))
 		args = append(args, *req.IsActive)
 	}
+	if req.Priority != nil {
+		argCount++
+		updates += ", priority = $" + string(rune(argCount+'0'))
+		args = append(args, *req.Priority)
+	}
 
 	argCount++
 	args = append(args, patternID)
@@ -157,11 +204,12 @@ func UpdateMerchantPattern(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update pattern"))
 		return
 	}
+	matcher.Invalidate(userID)
 
 	// Get updated pattern
 	var pattern models.MerchantPattern
-	err = db.DB.QueryRow("SELECT id, user_id, merchant_name, category_id, match_type, is_active, use_count, last_used_at, created_at, updated_at FROM merchant_patterns WHERE id = $1", patternID).Scan(
-		&pattern.ID, &pattern.UserID, &pattern.MerchantName, &pattern.CategoryID, &pattern.MatchType, &pattern.IsActive, &pattern.UseCount, &pattern.LastUsedAt, &pattern.CreatedAt, &pattern.UpdatedAt,
+	err = db.DB.QueryRow("SELECT id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at FROM merchant_patterns WHERE id = $1", patternID).Scan(
+		&pattern.ID, &pattern.UserID, &pattern.MerchantName, &pattern.CategoryID, &pattern.MatchType, &pattern.Priority, &pattern.FuzzyThreshold, &pattern.IsActive, &pattern.UseCount, &pattern.LastUsedAt, &pattern.CreatedAt, &pattern.UpdatedAt,
 	)
 	if err != nil {
 		logger.Log.Errorw("Failed to get updated pattern", "error", err)
@@ -204,10 +252,14 @@ func DeleteMerchantPattern(c *gin.Context) {
 		return
 	}
 
+	matcher.Invalidate(userID)
 	logger.Log.Infow("Pattern deleted", "patternId", patternID, "userId", userID)
 	c.Status(http.StatusNoContent)
 }
 
+// maxMatchCandidates is how many runners-up a match response lists
+const maxMatchCandidates = 5
+
 // MatchMerchantPattern tests if a merchant name matches any pattern
 func MatchMerchantPattern(c *gin.Context) {
 	userID, err := middleware.GetUserID(c)
@@ -222,49 +274,206 @@ func MatchMerchantPattern(c *gin.Context) {
 		return
 	}
 
-	// Get all active patterns
-	rows, err := db.DB.Query(`
-		SELECT id, user_id, merchant_name, category_id, match_type, is_active, use_count, last_used_at, created_at, updated_at
-		FROM merchant_patterns
-		WHERE user_id = $1 AND is_active = true
-		ORDER BY match_type ASC
-	`, userID)
+	compiled, err := matcher.ForUser(db.DB, userID)
 	if err != nil {
 		logger.Log.Errorw("Failed to get patterns", "error", err)
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to match pattern"))
 		return
 	}
+
+	// The first candidate is the winner; the rest are the runners-up
+	response := models.MatchPatternResponse{Candidates: []models.PatternCandidate{}}
+	candidates := compiled.MatchAll(req.MerchantName)
+	if len(candidates) > 0 {
+		pattern := candidates[0].Pattern
+		if err := matcher.RecordMatch(db.DB, &pattern, nil, models.PatternMatchSourceMatch); err != nil {
+			logger.Log.Errorw("Failed to record pattern match", "error", err, "patternId", pattern.ID)
+		}
+		response.Matched = true
+		response.Pattern = &pattern
+		response.Score = candidates[0].Score
+		candidates = candidates[1:]
+		if len(candidates) > maxMatchCandidates {
+			candidates = candidates[:maxMatchCandidates]
+		}
+		response.Candidates = candidates
+	}
+	c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+}
+
+// MatchMerchantPatternBatch matches many merchant names in one request, returning
+// a result for each name in the order given
+func MatchMerchantPatternBatch(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.BatchMatchPatternRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	compiled, err := matcher.ForUser(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to match patterns"))
+		return
+	}
+
+	results := make([]models.BatchMatchPatternResult, len(req.MerchantNames))
+	matched := []*models.MerchantPattern{}
+	for i, name := range req.MerchantNames {
+		pattern, score := compiled.MatchScore(name)
+		results[i] = models.BatchMatchPatternResult{
+			MerchantName: name,
+			Matched:      pattern != nil,
+			Pattern:      pattern,
+			Score:        score,
+		}
+		if pattern != nil {
+			matched = append(matched, pattern)
+		}
+	}
+
+	if err := matcher.RecordMatches(db.DB, matched, models.PatternMatchSourceMatch); err != nil {
+		logger.Log.Errorw("Failed to record pattern matches", "error", err, "userId", userID)
+	}
+	c.JSON(http.StatusOK, models.NewSuccessResponse(results))
+}
+
+// GetMerchantPatternConflicts lists active patterns that overlap on some merchant
+// name but assign different categories, along with which one wins
+func GetMerchantPatternConflicts(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	patterns, err := matcher.LoadActivePatterns(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to check pattern conflicts"))
+		return
+	}
+
+	// Merchant names the user has actually seen show overlaps between regex
+	// patterns, which have no literal text to test against
+	rows, err := db.DB.Query(`
+		SELECT merchant_name FROM expenses WHERE user_id = $1 AND merchant_name IS NOT NULL AND merchant_name <> ''
+		UNION
+		SELECT name FROM merchant_info WHERE user_id = $1
+		UNION
+		SELECT unnest(aliases) FROM merchant_info WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get merchant names", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to check pattern conflicts"))
+		return
+	}
 	defer rows.Close()
 
-	// Try to find a match
-	merchantNameLower := strings.ToLower(req.MerchantName)
+	samples := []string{}
 	for rows.Next() {
-		var p models.MerchantPattern
-		err := rows.Scan(&p.ID, &p.UserID, &p.MerchantName, &p.CategoryID, &p.MatchType, &p.IsActive, &p.UseCount, &p.LastUsedAt, &p.CreatedAt, &p.UpdatedAt)
-		if err != nil {
-			continue
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			samples = append(samples, name)
 		}
+	}
+	sort.Strings(samples)
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(matcher.Conflicts(patterns, samples)))
+}
 
-		patternNameLower := strings.ToLower(p.MerchantName)
-		matched := false
+// GetMerchantPatternStats reports, for each of the user's patterns, how often it
+// matched over the period and how often users changed the category it assigned
+func GetMerchantPatternStats(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	days, _ := strconv.Atoi(c.Query("days"))
+	if days < 1 || days > 365 {
+		days = 90
+	}
+	interval := c.DefaultQuery("interval", "week")
+	if interval != "day" && interval != "week" && interval != "month" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "interval must be day, week or month"))
+		return
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	// An auto-categorised expense counts as overridden when the user verified it
+	// with a different category from the one the pattern assigned. Expenses still
+	// waiting for review have not been corrected, so they are not counted.
+	rows, err := db.DB.Query(`
+		SELECT p.id, p.user_id, p.merchant_name, p.category_id, p.match_type, p.priority, p.fuzzy_threshold, p.is_active, p.use_count, p.last_used_at, p.created_at, p.updated_at,
+			COUNT(pm.id),
+			COUNT(e.id),
+			COUNT(e.id) FILTER (WHERE e.verified AND e.category_id <> pm.category_id)
+		FROM merchant_patterns p
+		LEFT JOIN pattern_matches pm ON pm.pattern_id = p.id AND pm.matched_at >= $2
+		LEFT JOIN expenses e ON e.id = pm.expense_id
+		WHERE p.user_id = $1
+		GROUP BY p.id
+		ORDER BY COUNT(pm.id) DESC, p.created_at ASC
+	`, userID, since)
+	if err != nil {
+		logger.Log.Errorw("Failed to get pattern stats", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get pattern stats"))
+		return
+	}
 
-		if p.MatchType == "exact" {
-			matched = merchantNameLower == patternNameLower
-		} else if p.MatchType == "contains" {
-			matched = strings.Contains(merchantNameLower, patternNameLower)
+	stats := []models.PatternStats{}
+	index := map[uuid.UUID]int{}
+	for rows.Next() {
+		var st models.PatternStats
+		p := &st.Pattern
+		err := rows.Scan(&p.ID, &p.UserID, &p.MerchantName, &p.CategoryID, &p.MatchType, &p.Priority, &p.FuzzyThreshold, &p.IsActive, &p.UseCount, &p.LastUsedAt, &p.CreatedAt, &p.UpdatedAt,
+			&st.Matches, &st.Categorised, &st.Overridden)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan pattern stats", "error", err)
+			continue
+		}
+		if st.Categorised > 0 {
+			st.OverrideRate = float64(st.Overridden) / float64(st.Categorised)
 		}
+		st.Series = []models.PatternStatsPoint{}
+		index[p.ID] = len(stats)
+		stats = append(stats, st)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(`
+		SELECT pattern_id, date_trunc($3, matched_at) AS period, COUNT(*)
+		FROM pattern_matches
+		WHERE user_id = $1 AND matched_at >= $2
+		GROUP BY pattern_id, period
+		ORDER BY period ASC
+	`, userID, since, interval)
+	if err != nil {
+		logger.Log.Errorw("Failed to get pattern match series", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get pattern stats"))
+		return
+	}
+	defer rows.Close()
 
-		if matched {
-			c.JSON(http.StatusOK, models.NewSuccessResponse(models.MatchPatternResponse{
-				Matched: true,
-				Pattern: &p,
-			}))
-			return
+	for rows.Next() {
+		var patternID uuid.UUID
+		var point models.PatternStatsPoint
+		if err := rows.Scan(&patternID, &point.Period, &point.Matches); err != nil {
+			logger.Log.Errorw("Failed to scan pattern match series", "error", err)
+			continue
+		}
+		if i, ok := index[patternID]; ok {
+			stats[i].Series = append(stats[i].Series, point)
 		}
 	}
 
-	c.JSON(http.StatusOK, models.NewSuccessResponse(models.MatchPatternResponse{
-		Matched: false,
-		Pattern: nil,
-	}))
+	c.JSON(http.StatusOK, models.NewSuccessResponse(stats))
 }
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/config"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/place"
+)
+
+const placeColumns = "p.id, p.user_id, p.name, p.latitude, p.longitude, p.radius, p.fix_count, p.created_at, p.updated_at"
+
+// scanPlace reads a row selected with placeColumns followed by the total
+// spent and number of expenses
+func scanPlace(row rowScanner) (models.Place, error) {
+	var p models.Place
+	var name sql.NullString
+	err := row.Scan(&p.ID, &p.UserID, &name, &p.Latitude, &p.Longitude, &p.Radius, &p.FixCount, &p.CreatedAt, &p.UpdatedAt,
+		&p.TotalSpent, &p.ExpenseCount)
+	if name.Valid {
+		p.Name = &name.String
+	}
+	return p, err
+}
+
+// placeSpendQuery selects places with the spend of the expenses linked to
+// their fixes. The expense date conditions are added to the join, so places
+// with no spending in the period are still listed.
+func placeSpendQuery(where, expenseWhere string) string {
+	return `SELECT ` + placeColumns + `, COALESCE(SUM(e.amount), 0), COUNT(e.id)
+		FROM places p
+		LEFT JOIN locations l ON l.place_id = p.id
+		LEFT JOIN expenses e ON e.location_id = l.id AND e.user_id = p.user_id` + expenseWhere + `
+		WHERE ` + where + `
+		GROUP BY p.id`
+}
+
+// fillDominantCategories sets the dominant category of each place that has one
+func fillDominantCategories(userID uuid.UUID, places []models.Place) error {
+	dominant, err := place.DominantCategories(db.DB, userID)
+	if err != nil {
+		return err
+	}
+	for i := range places {
+		if categoryID, ok := dominant[places[i].ID]; ok {
+			places[i].DominantCategoryID = &categoryID
+		}
+	}
+	return nil
+}
+
+// GetPlaces lists the user's places with what was spent at each, most first
+func GetPlaces(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	args := []interface{}{userID}
+	expenseWhere := ""
+	if startDate := c.Query("startDate"); startDate != "" {
+		start, err := parseDateParam(startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid startDate"))
+			return
+		}
+		args = append(args, start)
+		expenseWhere += " AND e.date >= $" + strconv.Itoa(len(args))
+	}
+	if endDate := c.Query("endDate"); endDate != "" {
+		end, err := parseDateParam(endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid endDate"))
+			return
+		}
+		// A bare date includes the whole day
+		if !strings.Contains(endDate, "T") {
+			end = end.AddDate(0, 0, 1)
+		}
+		args = append(args, end)
+		expenseWhere += " AND e.date < $" + strconv.Itoa(len(args))
+	}
+
+	minFixes, _ := strconv.Atoi(c.Query("minFixes"))
+	if minFixes < 1 {
+		minFixes = 1
+	}
+	args = append(args, minFixes)
+	where := "p.user_id = $1 AND p.fix_count >= $" + strconv.Itoa(len(args))
+
+	rows, err := db.DB.Query(placeSpendQuery(where, expenseWhere)+" ORDER BY COALESCE(SUM(e.amount), 0) DESC, p.fix_count DESC, p.created_at ASC", args...)
+	if err != nil {
+		logger.Log.Errorw("Failed to get places", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve places"))
+		return
+	}
+	defer rows.Close()
+
+	places := []models.Place{}
+	for rows.Next() {
+		p, err := scanPlace(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan place", "error", err)
+			continue
+		}
+		places = append(places, p)
+	}
+	rows.Close()
+
+	if err := fillDominantCategories(userID, places); err != nil {
+		logger.Log.Errorw("Failed to get place categories", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve places"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(places))
+}
+
+// UpdatePlace names or renames a place
+func UpdatePlace(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	placeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid place ID"))
+		return
+	}
+
+	var req models.UpdatePlaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	result, err := db.DB.Exec("UPDATE places SET name = $1, updated_at = $2 WHERE id = $3 AND user_id = $4",
+		nullString(strings.TrimSpace(*req.Name)), time.Now(), placeID, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to update place", "error", err, "placeId", placeID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update place"))
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Place not found"))
+		return
+	}
+
+	places := []models.Place{{}}
+	places[0], err = scanPlace(db.DB.QueryRow(placeSpendQuery("p.id = $1", ""), placeID))
+	if err == nil {
+		err = fillDominantCategories(userID, places)
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get updated place", "error", err, "placeId", placeID)
+	}
+	p := places[0]
+
+	logger.Log.Infow("Place updated", "placeId", placeID, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(p))
+}
+
+// RebuildPlaces clusters all of the user's location fixes into places again,
+// for fixes recorded before places existed or after changing PLACE_RADIUS
+func RebuildPlaces(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to rebuild places"))
+		return
+	}
+	defer tx.Rollback()
+
+	count, err := place.Rebuild(tx, userID, config.AppConfig.Location.PlaceRadius, config.AppConfig.Location.MaxAccuracy, time.Now())
+	if err != nil {
+		logger.Log.Errorw("Failed to rebuild places", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to rebuild places"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to rebuild places"))
+		return
+	}
+
+	logger.Log.Infow("Places rebuilt", "places", count, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(models.RebuildPlacesResponse{Places: count}))
+}
+
+// GetPlaceExpenses returns a place with the expenses linked to its fixes
+func GetPlaceExpenses(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	placeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid place ID"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	p, err := scanPlace(db.DB.QueryRow(placeSpendQuery("p.id = $1 AND p.user_id = $2", ""), placeID, userID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Place not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get place", "error", err, "placeId", placeID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get place expenses"))
+		return
+	}
+	places := []models.Place{p}
+	if err := fillDominantCategories(userID, places); err != nil {
+		logger.Log.Errorw("Failed to get place categories", "error", err, "placeId", placeID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get place expenses"))
+		return
+	}
+	p = places[0]
+
+	rows, err := db.DB.Query(`
+		SELECT `+expenseColumns+` FROM expenses
+		WHERE user_id = $1 AND location_id IN (SELECT id FROM locations WHERE place_id = $2)
+		ORDER BY date DESC LIMIT $3 OFFSET $4
+	`, userID, placeID, limit, offset)
+	if err != nil {
+		logger.Log.Errorw("Failed to get place expenses", "error", err, "placeId", placeID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get place expenses"))
+		return
+	}
+	defer rows.Close()
+
+	expenses := []models.Expense{}
+	for rows.Next() {
+		exp, err := scanExpense(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan expense", "error", err)
+			continue
+		}
+		expenses = append(expenses, exp)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(models.PlaceExpensesResponse{
+		Place:        p,
+		Expenses:     expenses,
+		TotalSpent:   p.TotalSpent,
+		ExpenseCount: p.ExpenseCount,
+	}))
+}
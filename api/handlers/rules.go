@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/rules"
+)
+
+// GetRules retrieves all rules for the user in the order they run
+func GetRules(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	list, err := listRules(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get rules", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to get rules"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(list))
+}
+
+// CreateRule creates a rule, last in the run order unless a position is given
+func CreateRule(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.CreateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+	if !checkRule(c, userID, req, "Failed to create rule") {
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create rule"))
+		return
+	}
+	defer tx.Rollback()
+
+	position, err := placeRule(tx, userID, uuid.Nil, req.Position)
+	if err != nil {
+		logger.Log.Errorw("Failed to position rule", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create rule"))
+		return
+	}
+
+	isActive, stopProcessing := true, true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+	if req.StopProcessing != nil {
+		stopProcessing = *req.StopProcessing
+	}
+
+	now := time.Now()
+	cond, act := req.Conditions, req.Actions
+	rule, err := rules.Scan(tx.QueryRow(`
+		INSERT INTO rules (user_id, name, position, is_active, stop_processing, merchant_name, merchant_match_type, min_amount, max_amount, account_id, days_of_week, source, description_keywords, set_category_id, set_description, set_verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		RETURNING `+rules.Columns,
+		userID, req.Name, position, isActive, stopProcessing,
+		cond.MerchantName, cond.MerchantMatchType, cond.MinAmount, cond.MaxAmount, cond.AccountID, cond.DaysOfWeek, cond.Source, cond.DescriptionKeywords,
+		act.CategoryID, act.Description, act.Verified, now, now,
+	))
+	if err != nil {
+		logger.Log.Errorw("Failed to create rule", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create rule"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create rule"))
+		return
+	}
+
+	logger.Log.Infow("Rule created", "ruleId", rule.ID, "userId", userID)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(rule))
+}
+
+// UpdateRule replaces a rule's definition. The rule keeps its place unless a position is given.
+func UpdateRule(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid rule ID"))
+		return
+	}
+
+	var req models.CreateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	existing, err := rules.Scan(db.DB.QueryRow("SELECT "+rules.Columns+" FROM rules WHERE id = $1", ruleID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Rule not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get rule", "error", err, "ruleId", ruleID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update rule"))
+		return
+	}
+	if existing.UserID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "Permission denied"))
+		return
+	}
+
+	if !checkRule(c, userID, req, "Failed to update rule") {
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update rule"))
+		return
+	}
+	defer tx.Rollback()
+
+	position := existing.Position
+	if req.Position != nil {
+		position, err = placeRule(tx, userID, ruleID, req.Position)
+		if err != nil {
+			logger.Log.Errorw("Failed to position rule", "error", err)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update rule"))
+			return
+		}
+	}
+
+	isActive, stopProcessing := existing.IsActive, existing.StopProcessing
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+	if req.StopProcessing != nil {
+		stopProcessing = *req.StopProcessing
+	}
+
+	cond, act := req.Conditions, req.Actions
+	rule, err := rules.Scan(tx.QueryRow(`
+		UPDATE rules
+		SET name = $1, position = $2, is_active = $3, stop_processing = $4,
+			merchant_name = $5, merchant_match_type = $6, min_amount = $7, max_amount = $8, account_id = $9, days_of_week = $10, source = $11, description_keywords = $12,
+			set_category_id = $13, set_description = $14, set_verified = $15, updated_at = $16
+		WHERE id = $17
+		RETURNING `+rules.Columns,
+		req.Name, position, isActive, stopProcessing,
+		cond.MerchantName, cond.MerchantMatchType, cond.MinAmount, cond.MaxAmount, cond.AccountID, cond.DaysOfWeek, cond.Source, cond.DescriptionKeywords,
+		act.CategoryID, act.Description, act.Verified, time.Now(), ruleID,
+	))
+	if err != nil {
+		logger.Log.Errorw("Failed to update rule", "error", err, "ruleId", ruleID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update rule"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to update rule"))
+		return
+	}
+
+	logger.Log.Infow("Rule updated", "ruleId", ruleID, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(rule))
+}
+
+// DeleteRule deletes a rule
+func DeleteRule(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid rule ID"))
+		return
+	}
+
+	var ownerID uuid.UUID
+	err = db.DB.QueryRow("SELECT user_id FROM rules WHERE id = $1", ruleID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Rule not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to get rule", "error", err, "ruleId", ruleID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete rule"))
+		return
+	}
+	if ownerID != userID {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(models.ErrCodeForbidden, "Permission denied"))
+		return
+	}
+
+	_, err = db.DB.Exec("DELETE FROM rules WHERE id = $1", ruleID)
+	if err != nil {
+		logger.Log.Errorw("Failed to delete rule", "error", err, "ruleId", ruleID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to delete rule"))
+		return
+	}
+
+	logger.Log.Infow("Rule deleted", "ruleId", ruleID, "userId", userID)
+	c.Status(http.StatusNoContent)
+}
+
+// ReorderRules sets the run order of all of the user's rules at once
+func ReorderRules(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.ReorderRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	// Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		logger.Log.Errorw("Failed to begin transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reorder rules"))
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM rules WHERE user_id = $1 FOR UPDATE", userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get rules", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reorder rules"))
+		return
+	}
+	owned := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			logger.Log.Errorw("Failed to scan rule", "error", err)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reorder rules"))
+			return
+		}
+		owned[id] = true
+	}
+	rows.Close()
+
+	seen := map[uuid.UUID]bool{}
+	for _, id := range req.RuleIDs {
+		if !owned[id] || seen[id] {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "ruleIds must list each of your rules exactly once"))
+			return
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(owned) {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "ruleIds must list each of your rules exactly once"))
+		return
+	}
+
+	now := time.Now()
+	for i, id := range req.RuleIDs {
+		if _, err := tx.Exec("UPDATE rules SET position = $1, updated_at = $2 WHERE id = $3", i, now, id); err != nil {
+			logger.Log.Errorw("Failed to reorder rule", "error", err, "ruleId", id)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reorder rules"))
+			return
+		}
+	}
+
+	list, err := listRules(tx, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get rules", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reorder rules"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Errorw("Failed to commit transaction", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reorder rules"))
+		return
+	}
+
+	logger.Log.Infow("Rules reordered", "count", len(req.RuleIDs), "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(list))
+}
+
+// TestRules runs the user's merchant patterns and active rules against a
+// described expense without saving anything, and explains what each rule did
+func TestRules(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.TestRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	in := rules.Input{
+		MerchantName: req.MerchantName,
+		Amount:       req.Amount,
+		AccountID:    req.AccountID,
+		Date:         time.Now(),
+		Source:       "auto",
+		Description:  req.Description,
+		RawText:      req.RawText,
+	}
+	if req.Date != nil {
+		in.Date = *req.Date
+	}
+	if req.Source != "" {
+		in.Source = req.Source
+	}
+
+	compiled, err := matcher.ForUser(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get patterns", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to test rules"))
+		return
+	}
+	active, err := rules.LoadActive(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get rules", "error", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to test rules"))
+		return
+	}
+
+	evaluation := rules.Evaluate(active, in)
+	response := models.TestRuleResponse{
+		Pattern:     compiled.Match(req.MerchantName),
+		CategoryID:  evaluation.CategoryID,
+		Description: evaluation.Description,
+		Verified:    evaluation.Verified,
+		Trace:       evaluation.Trace,
+	}
+	if response.CategoryID == nil && response.Pattern != nil {
+		response.CategoryID = &response.Pattern.CategoryID
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(response))
+}
+
+// checkRule validates a rule definition and that its account and category
+// belong to the user, writing the error response if not
+func checkRule(c *gin.Context, userID uuid.UUID, req models.CreateRuleRequest, failMessage string) bool {
+	if err := rules.Validate(req.Conditions, req.Actions); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return false
+	}
+
+	if req.Conditions.AccountID != nil {
+		var ownerID uuid.UUID
+		err := db.DB.QueryRow("SELECT user_id FROM accounts WHERE id = $1", *req.Conditions.AccountID).Scan(&ownerID)
+		if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Account not found"))
+			return false
+		}
+		if err != nil {
+			logger.Log.Errorw("Failed to get account", "error", err, "accountId", *req.Conditions.AccountID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, failMessage))
+			return false
+		}
+	}
+
+	if req.Actions.CategoryID != nil {
+		return checkCategoryType(c, userID, *req.Actions.CategoryID, models.CategoryTypeExpense, failMessage)
+	}
+	return true
+}
+
+// placeRule returns the position for a rule being saved. Without a requested
+// position that is after the user's other rules; otherwise the rules from that
+// position on move down one to make room.
+func placeRule(tx *sql.Tx, userID, ruleID uuid.UUID, requested *int) (int, error) {
+	if requested == nil {
+		var position int
+		err := tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM rules WHERE user_id = $1", userID).Scan(&position)
+		return position, err
+	}
+
+	_, err := tx.Exec("UPDATE rules SET position = position + 1 WHERE user_id = $1 AND position >= $2 AND id <> $3", userID, *requested, ruleID)
+	return *requested, err
+}
+
+// listRules returns all of the user's rules in the order they run
+func listRules(q rules.Querier, userID uuid.UUID) ([]models.Rule, error) {
+	rows, err := q.Query("SELECT "+rules.Columns+" FROM rules WHERE user_id = $1 ORDER BY position ASC, created_at ASC, id ASC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Rule{}
+	for rows.Next() {
+		r, err := rules.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
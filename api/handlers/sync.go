@@ -0,0 +1,792 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/parser"
+)
+
+const patternColumns = "id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at"
+
+// scanPattern reads a row selected with patternColumns
+func scanPattern(row rowScanner) (models.MerchantPattern, error) {
+	var p models.MerchantPattern
+	err := row.Scan(&p.ID, &p.UserID, &p.MerchantName, &p.CategoryID, &p.MatchType, &p.Priority, &p.FuzzyThreshold, &p.IsActive, &p.UseCount, &p.LastUsedAt, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// Record types in sync_id_mappings and sync_writes
+const (
+	mappingTransaction     = "transaction"
+	mappingExpense         = "expense"
+	mappingMerchantPattern = "merchant_pattern"
+)
+
+// syncSafetyMargin is how far before the end of a sync the next one starts
+// from, so a write that commits during the sync is not missed. Changes from
+// that time are sent twice.
+const syncSafetyMargin = time.Minute
+
+// maxServerChanges caps the records of each type returned by one sync
+const maxServerChanges = 500
+
+var syncMatchTypes = map[string]bool{
+	models.MatchTypeExact: true, models.MatchTypeContains: true, models.MatchTypeStartsWith: true, models.MatchTypeEndsWith: true,
+	models.MatchTypeWord: true, models.MatchTypeRegex: true, models.MatchTypeFuzzy: true,
+}
+
+// syncSession applies one device's changes, each record in its own database
+// transaction so a failure part way keeps what was already applied. A retried
+// sync finds those records through their ID mappings rather than creating them
+// again.
+type syncSession struct {
+	userID   uuid.UUID
+	deviceID string
+	lastSync *time.Time
+	resp     *models.IncrementalSyncResponse
+	// resend holds records the device must get back even if they have not
+	// changed since its last sync, because its own change to them lost
+	resend          map[string][]string
+	patternsChanged bool
+}
+
+// IncrementalSync applies the changes a device made offline and returns every
+// change to the user's transactions, expenses and patterns since its last sync
+func IncrementalSync(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.IncrementalSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	s := &syncSession{
+		userID:   userID,
+		deviceID: strings.TrimSpace(req.DeviceID),
+		lastSync: req.LastSyncTimestamp,
+		resp: &models.IncrementalSyncResponse{
+			Conflicts: []models.SyncConflict{},
+			IDMappings: models.SyncIDMappings{
+				Transactions:     map[string]string{},
+				Expenses:         map[string]string{},
+				MerchantPatterns: map[string]string{},
+			},
+		},
+		resend: map[string][]string{},
+	}
+
+	// Patterns go first so transactions are categorised with them, and expenses
+	// before transactions so a transaction can be linked to the expense the
+	// device made from it
+	for _, p := range req.Changes.MerchantPatterns {
+		if err := s.applyPattern(p); err != nil {
+			s.fail(c, err, "merchantPattern", p.ID)
+			return
+		}
+	}
+	if s.patternsChanged {
+		matcher.Invalidate(userID)
+	}
+
+	for _, e := range req.Changes.Expenses {
+		if err := s.applyExpense(e); err != nil {
+			s.fail(c, err, "expense", e.ID)
+			return
+		}
+	}
+
+	if len(req.Changes.Transactions) > 0 {
+		templates, err := loadUserTemplates(db.DB, userID)
+		if err != nil {
+			s.fail(c, err, "transaction", "")
+			return
+		}
+		for _, t := range req.Changes.Transactions {
+			if err := s.applyTransaction(t, templates); err != nil {
+				s.fail(c, err, "transaction", t.ID)
+				return
+			}
+		}
+	}
+
+	// Changes made after this point are sent on the next sync. Rows are stamped
+	// before they commit, so the point is set back to catch writes still in flight.
+	now := time.Now()
+	s.resp.SyncTimestamp = now.Add(-syncSafetyMargin)
+	if err := s.loadServerChanges(); err != nil {
+		s.fail(c, err, "serverChanges", "")
+		return
+	}
+
+	_, err = db.DB.Exec("UPDATE devices SET last_sync_at = $1, updated_at = $1 WHERE device_id = $2 AND user_id = $3", now, s.deviceID, userID)
+	if err != nil {
+		logger.Log.Warnw("Failed to record device sync time", "error", err, "deviceId", s.deviceID)
+	}
+
+	s.resp.Success = true
+	for _, conflict := range s.resp.Conflicts {
+		if conflict.Resolution == models.SyncResolutionRejected {
+			s.resp.Success = false
+		}
+	}
+
+	logger.Log.Infow("Incremental sync completed", "userId", userID, "deviceId", s.deviceID,
+		"transactions", len(req.Changes.Transactions), "expenses", len(req.Changes.Expenses), "merchantPatterns", len(req.Changes.MerchantPatterns),
+		"conflicts", len(s.resp.Conflicts))
+	c.JSON(http.StatusOK, models.NewSuccessResponse(s.resp))
+}
+
+// fail logs an error that stopped the sync and writes the error response
+func (s *syncSession) fail(c *gin.Context, err error, stage, localID string) {
+	if s.patternsChanged {
+		matcher.Invalidate(s.userID)
+	}
+	logger.Log.Errorw("Failed to sync", "error", err, "stage", stage, "localId", localID, "userId", s.userID, "deviceId", s.deviceID)
+	c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to sync changes"))
+}
+
+// begin starts the database transaction for one record. Records of a user are
+// applied one at a time, so two syncs of the same records cannot both miss
+// each other's ID mappings.
+func (s *syncSession) begin() (*sql.Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", s.userID.String()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// resolve finds the server ID of a record the device sent: the one mapped to
+// its local ID by an earlier sync, or the ID itself when it already is the ID
+// of one of the user's records in table. It reports false for a new record.
+func (s *syncSession) resolve(q dbExecutor, entity, table, localID string) (uuid.UUID, bool, error) {
+	var serverID uuid.UUID
+	err := q.QueryRow("SELECT server_id FROM sync_id_mappings WHERE user_id = $1 AND device_id = $2 AND entity_type = $3 AND local_id = $4",
+		s.userID, s.deviceID, entity, localID).Scan(&serverID)
+	if err == nil {
+		return serverID, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return uuid.Nil, false, err
+	}
+
+	id, err := uuid.Parse(localID)
+	if err != nil {
+		return uuid.Nil, false, nil
+	}
+	var exists bool
+	if err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = $1 AND user_id = $2)", id, s.userID).Scan(&exists); err != nil {
+		return uuid.Nil, false, err
+	}
+	return id, exists, nil
+}
+
+// saveMapping remembers the server ID given to a record the device created
+func (s *syncSession) saveMapping(q dbExecutor, entity, localID string, serverID uuid.UUID) error {
+	_, err := q.Exec(`
+		INSERT INTO sync_id_mappings (user_id, device_id, entity_type, local_id, server_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, device_id, entity_type, local_id) DO UPDATE SET server_id = EXCLUDED.server_id
+	`, s.userID, s.deviceID, entity, localID, serverID, time.Now())
+	return err
+}
+
+// mapID reports the server ID of a record whose local ID differs from it
+func mapID(mappings map[string]string, localID string, serverID uuid.UUID) {
+	if localID != serverID.String() {
+		mappings[localID] = serverID.String()
+	}
+}
+
+func (s *syncSession) conflict(recordType, localID string, serverID *uuid.UUID, resolution, reason string) {
+	conflict := models.SyncConflict{Type: recordType, LocalID: localID, Resolution: resolution, Reason: reason}
+	if serverID != nil {
+		conflict.ServerID = serverID.String()
+	}
+	s.resp.Conflicts = append(s.resp.Conflicts, conflict)
+}
+
+// compareVersions resolves a device's change to a record by last write wins,
+// taking the local version's createdAt when it has no updatedAt. It reports
+// whether the device's version is applied, recording a conflict when the
+// server's version is newer or changed since the device last synced. A server
+// version the device wrote itself is never a conflict, since the device made
+// its change on top of it.
+func (s *syncSession) compareVersions(q dbExecutor, entity, recordType, localID string, serverID uuid.UUID, serverUpdatedAt, localCreatedAt, localUpdatedAt time.Time) (bool, error) {
+	var own bool
+	err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM sync_writes WHERE user_id = $1 AND device_id = $2 AND entity_type = $3 AND server_id = $4 AND updated_at = $5)",
+		s.userID, s.deviceID, entity, serverID, serverUpdatedAt).Scan(&own)
+	if err != nil {
+		return false, err
+	}
+	if own {
+		return true, nil
+	}
+
+	if localUpdatedAt.IsZero() {
+		localUpdatedAt = localCreatedAt
+	}
+	if serverUpdatedAt.After(localUpdatedAt) {
+		s.conflict(recordType, localID, &serverID, models.SyncResolutionServerWins, "Server version is newer")
+		s.resend[recordType] = append(s.resend[recordType], serverID.String())
+		return false, nil
+	}
+	if s.lastSync != nil && serverUpdatedAt.After(*s.lastSync) {
+		s.conflict(recordType, localID, &serverID, models.SyncResolutionClientWins, "Local version is newer")
+	}
+	return true, nil
+}
+
+// recordWrite remembers the version of a record this device just saved, read
+// back from table, so its next change to the record is compared against it
+func (s *syncSession) recordWrite(q dbExecutor, entity, table string, serverID uuid.UUID) error {
+	_, err := q.Exec(`
+		INSERT INTO sync_writes (user_id, device_id, entity_type, server_id, updated_at)
+		SELECT user_id, $1, $2, id, updated_at FROM `+table+` WHERE id = $3
+		ON CONFLICT (user_id, device_id, entity_type, server_id) DO UPDATE SET updated_at = EXCLUDED.updated_at
+	`, s.deviceID, entity, serverID)
+	return err
+}
+
+// forgetWrites drops the versions any device saved of a record deleted by a sync
+func (s *syncSession) forgetWrites(q dbExecutor, entity string, serverID uuid.UUID) error {
+	_, err := q.Exec("DELETE FROM sync_writes WHERE user_id = $1 AND entity_type = $2 AND server_id = $3", s.userID, entity, serverID)
+	return err
+}
+
+// keepServerVersion ends a record's database transaction without the device's
+// change, still reporting the server ID so the device can take the server's version
+func (s *syncSession) keepServerVersion(tx *sql.Tx, mappings map[string]string, localID string, serverID uuid.UUID) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	mapID(mappings, localID, serverID)
+	return nil
+}
+
+// checkExpenseFields returns a message describing the first problem with an expense the device sent
+func (s *syncSession) checkExpenseFields(q dbExecutor, e models.SyncExpense) (string, error) {
+	if e.Amount <= 0 {
+		return "amount must be greater than 0", nil
+	}
+	if e.Date.IsZero() {
+		return "date is required", nil
+	}
+
+	if msg, err := s.checkCategory(q, e.CategoryID); msg != "" || err != nil {
+		return msg, err
+	}
+
+	var exists bool
+	if err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2)", e.AccountID, s.userID).Scan(&exists); err != nil {
+		return "", err
+	}
+	if !exists {
+		return "Account not found", nil
+	}
+	return "", nil
+}
+
+// applyExpense creates, updates or deletes an expense the device changed
+func (s *syncSession) applyExpense(e models.SyncExpense) error {
+	if e.ID == "" {
+		s.conflict(models.SyncTypeExpense, e.ID, nil, models.SyncResolutionRejected, "id is required")
+		return nil
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	expenseID, found, err := s.resolve(tx, mappingExpense, "expenses", e.ID)
+	if err != nil {
+		return err
+	}
+
+	var current models.Expense
+	if found {
+		err = tx.QueryRow("SELECT amount, account_id, merchant_id, updated_at FROM expenses WHERE id = $1 AND user_id = $2 FOR UPDATE", expenseID, s.userID).
+			Scan(&current.Amount, &current.AccountID, &current.MerchantID, &current.UpdatedAt)
+		if err == sql.ErrNoRows {
+			if !e.Deleted {
+				s.conflict(models.SyncTypeExpense, e.ID, &expenseID, models.SyncResolutionServerWins, "Deleted on the server")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		current.ID = expenseID
+	}
+
+	switch {
+	case !found && e.Deleted:
+		// Created and deleted before the server heard of it
+		return nil
+
+	case found && e.Deleted:
+		applied, err := s.compareVersions(tx, mappingExpense, models.SyncTypeExpense, e.ID, expenseID, current.UpdatedAt, e.CreatedAt, e.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return s.keepServerVersion(tx, s.resp.IDMappings.Expenses, e.ID, expenseID)
+		}
+		if err := removeExpense(tx, s.userID, current); err != nil {
+			return err
+		}
+		if err := s.forgetWrites(tx, mappingExpense, expenseID); err != nil {
+			return err
+		}
+
+	default:
+		msg, err := s.checkExpenseFields(tx, e)
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			s.conflict(models.SyncTypeExpense, e.ID, nil, models.SyncResolutionRejected, msg)
+			return nil
+		}
+
+		if !found {
+			expense, err := insertExpense(tx, s.userID, models.CreateExpenseRequest{
+				Amount:       e.Amount,
+				CategoryID:   e.CategoryID,
+				AccountID:    e.AccountID,
+				Date:         e.Date,
+				Description:  e.Description,
+				MerchantName: e.MerchantName,
+			}, e.Verified)
+			if err != nil {
+				return err
+			}
+			expenseID = expense.ID
+			if err := s.saveMapping(tx, mappingExpense, e.ID, expenseID); err != nil {
+				return err
+			}
+			break
+		}
+
+		applied, err := s.compareVersions(tx, mappingExpense, models.SyncTypeExpense, e.ID, expenseID, current.UpdatedAt, e.CreatedAt, e.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return s.keepServerVersion(tx, s.resp.IDMappings.Expenses, e.ID, expenseID)
+		}
+		if err := s.updateExpense(tx, current, e); err != nil {
+			return err
+		}
+	}
+
+	if !e.Deleted {
+		if err := s.recordWrite(tx, mappingExpense, "expenses", expenseID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	mapID(s.resp.IDMappings.Expenses, e.ID, expenseID)
+	return nil
+}
+
+// updateExpense overwrites an expense with the device's version, moving the
+// amount between account balances and merchant counters as needed
+func (s *syncSession) updateExpense(q dbExecutor, current models.Expense, e models.SyncExpense) error {
+	merchantID, err := merchant.Upsert(q, s.userID, e.MerchantName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = q.Exec(`
+		UPDATE expenses
+		SET amount = $1, category_id = $2, account_id = $3, date = $4, description = $5, merchant_id = $6, merchant_name = $7, verified = $8, updated_at = $9
+		WHERE id = $10
+	`, e.Amount, e.CategoryID, e.AccountID, e.Date, e.Description, merchantID, e.MerchantName, e.Verified, now, current.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance + $1, total_spent = total_spent - $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, current.Amount, now, current.AccountID, s.userID)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance - $1, total_spent = total_spent + $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, e.Amount, now, e.AccountID, s.userID)
+	if err != nil {
+		return err
+	}
+
+	return merchant.Refresh(q, current.MerchantID, merchantID)
+}
+
+// checkPatternFields returns a message describing the first problem with a pattern the device sent
+func (s *syncSession) checkPatternFields(q dbExecutor, p models.SyncMerchantPattern) (string, error) {
+	if !syncMatchTypes[p.MatchType] {
+		return "matchType must be one of exact, contains, starts_with, ends_with, word, regex, fuzzy", nil
+	}
+	if err := matcher.Validate(p.MatchType, p.MerchantName); err != nil {
+		return err.Error(), nil
+	}
+	if err := matcher.ValidateThreshold(p.MatchType, p.FuzzyThreshold); err != nil {
+		return err.Error(), nil
+	}
+
+	return s.checkCategory(q, p.CategoryID)
+}
+
+// checkCategory returns a message if the category is not one of the user's expense categories
+func (s *syncSession) checkCategory(q dbExecutor, categoryID uuid.UUID) (string, error) {
+	var categoryType string
+	err := q.QueryRow("SELECT type FROM categories WHERE id = $1 AND (user_id IS NULL OR user_id = $2)", categoryID, s.userID).Scan(&categoryType)
+	if err == sql.ErrNoRows {
+		return "Category not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if categoryType != models.CategoryTypeExpense {
+		return "Category must be an " + models.CategoryTypeExpense + " category", nil
+	}
+	return "", nil
+}
+
+// applyPattern creates, updates or deletes a merchant pattern the device
+// changed. A new pattern for a merchant that already has one is taken as a
+// change to that pattern.
+func (s *syncSession) applyPattern(p models.SyncMerchantPattern) error {
+	if p.ID == "" {
+		s.conflict(models.SyncTypeMerchantPattern, p.ID, nil, models.SyncResolutionRejected, "id is required")
+		return nil
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	patternID, found, err := s.resolve(tx, mappingMerchantPattern, "merchant_patterns", p.ID)
+	if err != nil {
+		return err
+	}
+	if !found && !p.Deleted {
+		err = tx.QueryRow("SELECT id FROM merchant_patterns WHERE user_id = $1 AND merchant_name = $2", s.userID, p.MerchantName).Scan(&patternID)
+		if err == nil {
+			found = true
+			if err := s.saveMapping(tx, mappingMerchantPattern, p.ID, patternID); err != nil {
+				return err
+			}
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	var current models.MerchantPattern
+	if found {
+		current, err = scanPattern(tx.QueryRow("SELECT "+patternColumns+" FROM merchant_patterns WHERE id = $1 AND user_id = $2 FOR UPDATE", patternID, s.userID))
+		if err == sql.ErrNoRows {
+			if !p.Deleted {
+				s.conflict(models.SyncTypeMerchantPattern, p.ID, &patternID, models.SyncResolutionServerWins, "Deleted on the server")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case !found && p.Deleted:
+		return nil
+
+	case found && p.Deleted:
+		applied, err := s.compareVersions(tx, mappingMerchantPattern, models.SyncTypeMerchantPattern, p.ID, patternID, current.UpdatedAt, p.CreatedAt, p.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return s.keepServerVersion(tx, s.resp.IDMappings.MerchantPatterns, p.ID, patternID)
+		}
+		if _, err := tx.Exec("DELETE FROM merchant_patterns WHERE id = $1", patternID); err != nil {
+			return err
+		}
+		if err := s.forgetWrites(tx, mappingMerchantPattern, patternID); err != nil {
+			return err
+		}
+
+	default:
+		msg, err := s.checkPatternFields(tx, p)
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			s.conflict(models.SyncTypeMerchantPattern, p.ID, nil, models.SyncResolutionRejected, msg)
+			return nil
+		}
+		threshold := p.FuzzyThreshold
+		if p.MatchType != models.MatchTypeFuzzy {
+			threshold = nil
+		}
+
+		if !found {
+			isActive := p.IsActive == nil || *p.IsActive
+			now := time.Now()
+			err = tx.QueryRow(`
+				INSERT INTO merchant_patterns (user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				RETURNING id
+			`, s.userID, p.MerchantName, p.CategoryID, p.MatchType, p.Priority, threshold, isActive, 0, now, now).Scan(&patternID)
+			if err != nil {
+				return err
+			}
+			if err := s.saveMapping(tx, mappingMerchantPattern, p.ID, patternID); err != nil {
+				return err
+			}
+			break
+		}
+
+		applied, err := s.compareVersions(tx, mappingMerchantPattern, models.SyncTypeMerchantPattern, p.ID, patternID, current.UpdatedAt, p.CreatedAt, p.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return s.keepServerVersion(tx, s.resp.IDMappings.MerchantPatterns, p.ID, patternID)
+		}
+		if p.MerchantName != current.MerchantName {
+			var taken bool
+			err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM merchant_patterns WHERE user_id = $1 AND merchant_name = $2 AND id <> $3)", s.userID, p.MerchantName, patternID).Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if taken {
+				s.conflict(models.SyncTypeMerchantPattern, p.ID, &patternID, models.SyncResolutionRejected, "Pattern already exists for this merchant")
+				return nil
+			}
+		}
+		isActive := current.IsActive
+		if p.IsActive != nil {
+			isActive = *p.IsActive
+		}
+		_, err = tx.Exec(`
+			UPDATE merchant_patterns
+			SET merchant_name = $1, category_id = $2, match_type = $3, priority = $4, fuzzy_threshold = $5, is_active = $6, updated_at = $7
+			WHERE id = $8
+		`, p.MerchantName, p.CategoryID, p.MatchType, p.Priority, threshold, isActive, time.Now(), patternID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.Deleted {
+		if err := s.recordWrite(tx, mappingMerchantPattern, "merchant_patterns", patternID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.patternsChanged = true
+	mapID(s.resp.IDMappings.MerchantPatterns, p.ID, patternID)
+	return nil
+}
+
+// applyTransaction stores a transaction the device recorded. Transactions are
+// never changed by devices, so one the server already has is only mapped. A
+// transaction linked to an expense the server knows is marked processed with
+// it; any other goes through the processing pipeline like an uploaded one.
+func (s *syncSession) applyTransaction(t models.SyncTransaction, templates []*parser.Template) error {
+	if t.ID == "" {
+		s.conflict(models.SyncTypeTransaction, t.ID, nil, models.SyncResolutionRejected, "id is required")
+		return nil
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	transactionID, found, err := s.resolve(tx, mappingTransaction, "transactions", t.ID)
+	if err != nil {
+		return err
+	}
+	if found {
+		mapID(s.resp.IDMappings.Transactions, t.ID, transactionID)
+		return nil
+	}
+
+	txn := t.Transaction
+	txn.ExpenseID = nil
+	txn.DeviceID = s.deviceID
+	if msg := validateTransaction(txn); msg != "" {
+		s.conflict(models.SyncTypeTransaction, t.ID, nil, models.SyncResolutionRejected, msg)
+		return nil
+	}
+
+	var expenseID *uuid.UUID
+	if t.ExpenseID != "" {
+		id, ok, err := s.resolve(tx, mappingExpense, "expenses", t.ExpenseID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			expenseID = &id
+		}
+	}
+
+	saved, err := insertTransaction(tx, s.userID, txn, templates)
+	if err != nil {
+		return err
+	}
+	if expenseID != nil {
+		linked, err := scanTransaction(tx.QueryRow(`
+			UPDATE transactions SET processed = true, expense_id = $1, updated_at = $2
+			WHERE id = $3 AND EXISTS (SELECT 1 FROM expenses WHERE id = $1 AND user_id = $4)
+			RETURNING `+transactionColumns,
+			*expenseID, time.Now(), saved.ID, s.userID,
+		))
+		switch {
+		case err == sql.ErrNoRows:
+			// The mapped expense has since been deleted
+			expenseID = nil
+		case err != nil:
+			return err
+		default:
+			saved = linked
+		}
+	}
+	if err := s.saveMapping(tx, mappingTransaction, t.ID, saved.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if expenseID == nil {
+		promoteTransaction(s.userID, &saved)
+	}
+	mapID(s.resp.IDMappings.Transactions, t.ID, saved.ID)
+	return nil
+}
+
+// loadServerChanges fills in every record changed since the device last
+// synced, including those this sync wrote so the device gets the server's
+// version of them, and those whose change by the device lost a conflict
+func (s *syncSession) loadServerChanges() error {
+	var since time.Time
+	if s.lastSync != nil {
+		since = *s.lastSync
+	}
+	changes := &s.resp.ServerChanges
+
+	changes.Transactions = []models.Transaction{}
+	err := s.loadChanges("transactions", transactionColumns, models.SyncTypeTransaction, since, func(rows *sql.Rows) error {
+		txn, err := scanTransaction(rows)
+		if err == nil {
+			changes.Transactions = append(changes.Transactions, txn)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	changes.Expenses = []models.Expense{}
+	err = s.loadChanges("expenses", expenseColumns, models.SyncTypeExpense, since, func(rows *sql.Rows) error {
+		exp, err := scanExpense(rows)
+		if err == nil {
+			changes.Expenses = append(changes.Expenses, exp)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	changes.MerchantPatterns = []models.MerchantPattern{}
+	return s.loadChanges("merchant_patterns", patternColumns, models.SyncTypeMerchantPattern, since, func(rows *sql.Rows) error {
+		p, err := scanPattern(rows)
+		if err == nil {
+			changes.MerchantPatterns = append(changes.MerchantPatterns, p)
+		}
+		return err
+	})
+}
+
+// loadChanges selects the rows of a table changed since the given time, at
+// most maxServerChanges of them plus any sharing the last one's updated_at,
+// and the rows to resend. When rows are left over, the response's
+// syncTimestamp is moved back so the next sync starts after the last row sent.
+func (s *syncSession) loadChanges(table, columns, recordType string, since time.Time, scan func(*sql.Rows) error) error {
+	var cutoff *time.Time
+	var last time.Time
+	err := db.DB.QueryRow("SELECT updated_at FROM "+table+" WHERE user_id = $1 AND updated_at > $2 ORDER BY updated_at ASC OFFSET $3 LIMIT 1",
+		s.userID, since, maxServerChanges-1).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		var more bool
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM "+table+" WHERE user_id = $1 AND updated_at > $2)", s.userID, last).Scan(&more); err != nil {
+			return err
+		}
+		if more {
+			cutoff = &last
+			s.resp.HasMore = true
+			if last.Before(s.resp.SyncTimestamp) {
+				s.resp.SyncTimestamp = last
+			}
+		}
+	}
+
+	rows, err := db.DB.Query("SELECT "+columns+" FROM "+table+`
+		WHERE user_id = $1 AND ((updated_at > $2 AND ($3::timestamp IS NULL OR updated_at <= $3)) OR id = ANY($4::uuid[]))
+		ORDER BY updated_at ASC
+	`, s.userID, since, cutoff, pq.Array(s.resend[recordType]))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/processor"
+)
+
+// GetUnassignedTransactions lists parsed transactions the resolver could not place in an account
+func GetUnassignedTransactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+transactionColumns+` FROM transactions
+		WHERE user_id = $1 AND processed = false AND unassigned_reason IS NOT NULL
+		ORDER BY timestamp DESC
+	`, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get unassigned transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve unassigned transactions"))
+		return
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		txn, err := scanTransaction(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan transaction", "error", err)
+			continue
+		}
+		transactions = append(transactions, txn)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(transactions))
+}
+
+// AssignTransaction promotes a transaction into the account the user picked. With
+// rememberIdentifier, the transaction's last 4 digits are added to the account so
+// similar transactions are placed automatically from then on.
+func AssignTransaction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid transaction ID"))
+		return
+	}
+
+	var req models.AssignTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	result, err := processor.ProcessWithAccount(userID, transactionID, req.AccountID)
+	if err == processor.ErrTransactionNotFound {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Transaction not found"))
+		return
+	}
+	if err == processor.ErrAccountNotFound {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Account not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to assign transaction", "error", err, "transactionId", transactionID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to assign transaction"))
+		return
+	}
+
+	if req.RememberIdentifier && result.Status == models.ProcessStatusCreated {
+		var last4 sql.NullString
+		err := db.DB.QueryRow("SELECT account_last4 FROM transactions WHERE id = $1", transactionID).Scan(&last4)
+		if err == nil && len(last4.String) == 4 {
+			_, err = insertAccountIdentifier(db.DB, userID, req.AccountID, models.IdentifierTypeLast4, last4.String)
+		}
+		if err != nil {
+			logger.Log.Warnw("Failed to remember account identifier", "error", err, "transactionId", transactionID)
+		}
+	}
+
+	logger.Log.Infow("Transaction assigned", "transactionId", transactionID, "accountId", req.AccountID, "status", result.Status, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(result))
+}
+
+// DismissTransaction removes a transaction from the unassigned queue without
+// creating an expense or income, e.g. for transfers between the user's own accounts
+func DismissTransaction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid transaction ID"))
+		return
+	}
+
+	txn, err := scanTransaction(db.DB.QueryRow(`
+		UPDATE transactions SET processed = true, unassigned_reason = NULL, updated_at = $1
+		WHERE id = $2 AND user_id = $3 AND processed = false AND unassigned_reason IS NOT NULL
+		RETURNING `+transactionColumns,
+		time.Now(), transactionID, userID,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Unassigned transaction not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to dismiss transaction", "error", err, "transactionId", transactionID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to dismiss transaction"))
+		return
+	}
+
+	logger.Log.Infow("Transaction dismissed", "transactionId", transactionID, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(txn))
+}
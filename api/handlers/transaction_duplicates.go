@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// GetDuplicateTransactions lists transactions linked as duplicates, each with its original
+func GetDuplicateTransactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	status := c.DefaultQuery("status", models.DuplicateStatusLinked)
+	if status != models.DuplicateStatusLinked && status != models.DuplicateStatusConfirmed && status != models.DuplicateStatusRejected {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "status must be linked, confirmed or rejected"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+transactionColumns+` FROM transactions
+		WHERE user_id = $1 AND duplicate_of IS NOT NULL AND duplicate_status = $2
+		ORDER BY timestamp DESC
+		LIMIT $3 OFFSET $4
+	`, userID, status, limit, (page-1)*limit)
+	if err != nil {
+		logger.Log.Errorw("Failed to get duplicate transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve duplicate transactions"))
+		return
+	}
+
+	duplicates := []models.Transaction{}
+	originalIDs := []string{}
+	for rows.Next() {
+		txn, err := scanTransaction(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan transaction", "error", err)
+			continue
+		}
+		duplicates = append(duplicates, txn)
+		originalIDs = append(originalIDs, txn.DuplicateOf.String())
+	}
+	rows.Close()
+
+	originals := map[uuid.UUID]models.Transaction{}
+	if len(originalIDs) > 0 {
+		rows, err = db.DB.Query("SELECT "+transactionColumns+" FROM transactions WHERE user_id = $1 AND id = ANY($2::uuid[])", userID, pq.Array(originalIDs))
+		if err != nil {
+			logger.Log.Errorw("Failed to get original transactions", "error", err, "userId", userID)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve duplicate transactions"))
+			return
+		}
+		for rows.Next() {
+			txn, err := scanTransaction(rows)
+			if err != nil {
+				logger.Log.Errorw("Failed to scan transaction", "error", err)
+				continue
+			}
+			originals[txn.ID] = txn
+		}
+		rows.Close()
+	}
+
+	pairs := make([]models.DuplicateTransactionPair, 0, len(duplicates))
+	for _, txn := range duplicates {
+		pairs = append(pairs, models.DuplicateTransactionPair{
+			Duplicate: txn,
+			Original:  originals[*txn.DuplicateOf],
+		})
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(pairs))
+}
+
+// ConfirmDuplicateTransaction accepts a duplicate link so it no longer shows up for review
+func ConfirmDuplicateTransaction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid transaction ID"))
+		return
+	}
+
+	txn, err := scanTransaction(db.DB.QueryRow(`
+		UPDATE transactions SET duplicate_status = $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4 AND duplicate_of IS NOT NULL AND duplicate_status = $5
+		RETURNING `+transactionColumns,
+		models.DuplicateStatusConfirmed, time.Now(), transactionID, userID, models.DuplicateStatusLinked,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Duplicate awaiting review not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to confirm duplicate", "error", err, "transactionId", transactionID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to confirm duplicate"))
+		return
+	}
+
+	logger.Log.Infow("Duplicate confirmed", "transactionId", transactionID, "duplicateOf", txn.DuplicateOf, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(txn))
+}
+
+// UndoDuplicateTransaction rejects a duplicate link. The transaction is treated as
+// an original from then on and is run through the processing pipeline.
+func UndoDuplicateTransaction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid transaction ID"))
+		return
+	}
+
+	txn, err := scanTransaction(db.DB.QueryRow(`
+		UPDATE transactions SET duplicate_status = $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4 AND duplicate_of IS NOT NULL AND duplicate_status IN ($5, $6)
+		RETURNING `+transactionColumns,
+		models.DuplicateStatusRejected, time.Now(), transactionID, userID, models.DuplicateStatusLinked, models.DuplicateStatusConfirmed,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Duplicate not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to undo duplicate", "error", err, "transactionId", transactionID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to undo duplicate"))
+		return
+	}
+
+	promoteTransaction(userID, &txn)
+
+	logger.Log.Infow("Duplicate undone", "transactionId", transactionID, "duplicateOf", txn.DuplicateOf, "userId", userID)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(txn))
+}
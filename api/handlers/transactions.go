@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/api/middleware"
+	"github.com/sooraj1002/expense-tracker/config"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/dedup"
+	"github.com/sooraj1002/expense-tracker/location"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/parser"
+	"github.com/sooraj1002/expense-tracker/processor"
+)
+
+const transactionColumns = "id, user_id, raw_text, timestamp, sender_info, amount, merchant_name, merchant_id, account_last4, bank, direction, reference_number, parse_template, parsed, processed, expense_id, income_id, device_id, location_id, fingerprint, duplicate_of, duplicate_status, duplicate_reason, unassigned_reason, created_at, updated_at"
+
+// dbExecutor is implemented by both *sql.DB and *sql.Tx
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// GetTransactions retrieves raw transactions with filters and pagination
+func GetTransactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	where := " WHERE user_id = $1"
+	args := []interface{}{userID}
+	argCount := 1
+
+	for _, param := range []string{"processed", "parsed"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid value for "+param))
+			return
+		}
+		argCount++
+		where += " AND " + param + " = $" + strconv.Itoa(argCount)
+		args = append(args, flag)
+	}
+	if sender := strings.TrimSpace(c.Query("sender")); sender != "" {
+		argCount++
+		where += " AND sender_info ILIKE $" + strconv.Itoa(argCount)
+		args = append(args, "%"+sender+"%")
+	}
+	if startDate := c.Query("startDate"); startDate != "" {
+		start, err := parseDateParam(startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid startDate"))
+			return
+		}
+		argCount++
+		where += " AND timestamp >= $" + strconv.Itoa(argCount)
+		args = append(args, start)
+	}
+	if endDate := c.Query("endDate"); endDate != "" {
+		end, err := parseDateParam(endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid endDate"))
+			return
+		}
+		// A bare date includes the whole day
+		if !strings.Contains(endDate, "T") {
+			end = end.AddDate(0, 0, 1)
+		}
+		argCount++
+		where += " AND timestamp < $" + strconv.Itoa(argCount)
+		args = append(args, end)
+	}
+
+	var total int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM transactions"+where, args...).Scan(&total)
+	if err != nil {
+		logger.Log.Errorw("Failed to count transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve transactions"))
+		return
+	}
+
+	query := "SELECT " + transactionColumns + " FROM transactions" + where + " ORDER BY timestamp DESC"
+	argCount++
+	query += " LIMIT $" + strconv.Itoa(argCount)
+	args = append(args, limit)
+	argCount++
+	query += " OFFSET $" + strconv.Itoa(argCount)
+	args = append(args, offset)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		logger.Log.Errorw("Failed to get transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve transactions"))
+		return
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		txn, err := scanTransaction(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan transaction", "error", err)
+			continue
+		}
+		transactions = append(transactions, txn)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(models.TransactionListResponse{
+		Transactions: transactions,
+		Total:        total,
+	}))
+}
+
+// GetUnparsedTransactionSummary groups unparsed transactions by sender so failing formats can be spotted
+func GetUnparsedTransactionSummary(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT COALESCE(sender_info, ''), COUNT(*), MAX(timestamp), (ARRAY_AGG(raw_text ORDER BY timestamp DESC))[1]
+		FROM transactions
+		WHERE user_id = $1 AND parsed = false
+		GROUP BY COALESCE(sender_info, '')
+		ORDER BY COUNT(*) DESC
+	`, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to summarise unparsed transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to retrieve unparsed transactions"))
+		return
+	}
+	defer rows.Close()
+
+	summary := []models.UnparsedSenderSummary{}
+	for rows.Next() {
+		var s models.UnparsedSenderSummary
+		if err := rows.Scan(&s.SenderInfo, &s.Count, &s.LastSeenAt, &s.SampleText); err != nil {
+			logger.Log.Errorw("Failed to scan unparsed summary", "error", err)
+			continue
+		}
+		summary = append(summary, s)
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(summary))
+}
+
+// CreateTransaction stores a single raw notification/SMS transaction
+func CreateTransaction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.CreateTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	txn := models.Transaction{
+		RawText:      req.RawText,
+		Timestamp:    req.Timestamp,
+		SenderInfo:   req.SenderInfo,
+		MerchantName: req.MerchantName,
+		AccountLast4: req.AccountLast4,
+		DeviceID:     req.DeviceID,
+	}
+	if req.Amount > 0 {
+		amount := req.Amount
+		txn.Amount = &amount
+	}
+
+	templates, err := loadUserTemplates(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to load parser templates", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create transaction"))
+		return
+	}
+
+	saved, err := storeTransaction(userID, txn, templates)
+	if err != nil {
+		logger.Log.Errorw("Failed to create transaction", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to create transaction"))
+		return
+	}
+
+	promoteTransaction(userID, &saved)
+
+	logger.Log.Infow("Transaction created", "transactionId", saved.ID, "userId", userID, "duplicateOf", saved.DuplicateOf)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(saved))
+}
+
+// BatchCreateTransactions stores many raw transactions, reporting the outcome of each item
+func BatchCreateTransactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	var req models.BatchTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, err.Error()))
+		return
+	}
+
+	templates, err := loadUserTemplates(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to load parser templates", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to store transactions"))
+		return
+	}
+
+	resp := models.BatchTransactionResponse{
+		TransactionIDs: []string{},
+		Results:        make([]models.BatchTransactionResult, 0, len(req.Transactions)),
+	}
+
+	for i, txn := range req.Transactions {
+		result := models.BatchTransactionResult{Index: i}
+
+		if msg := validateTransaction(txn); msg != "" {
+			result.Error = msg
+			resp.Failed++
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		txn.DeviceID = req.DeviceID
+		saved, err := storeTransaction(userID, txn, templates)
+		if err != nil {
+			logger.Log.Errorw("Failed to create transaction in batch", "error", err, "userId", userID, "index", i)
+			result.Error = "Failed to store transaction"
+			resp.Failed++
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		promoteTransaction(userID, &saved)
+
+		result.Success = true
+		result.TransactionID = saved.ID.String()
+		if saved.ExpenseID != nil {
+			result.ExpenseID = saved.ExpenseID.String()
+		}
+		if saved.IncomeID != nil {
+			result.IncomeID = saved.IncomeID.String()
+		}
+		if saved.IsDuplicate() {
+			result.Duplicate = true
+			result.DuplicateOf = saved.DuplicateOf.String()
+			resp.Duplicates++
+		}
+		resp.Processed++
+		resp.TransactionIDs = append(resp.TransactionIDs, saved.ID.String())
+		resp.Results = append(resp.Results, result)
+	}
+	resp.Success = resp.Failed == 0
+
+	logger.Log.Infow("Transaction batch stored", "userId", userID, "deviceId", req.DeviceID, "processed", resp.Processed, "failed", resp.Failed, "duplicates", resp.Duplicates)
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(resp))
+}
+
+// ReparseTransactions re-runs the parser over the user's unparsed transactions,
+// picking up templates added or fixed since they were stored
+func ReparseTransactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	templates, err := loadUserTemplates(db.DB, userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to load parser templates", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reparse transactions"))
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+transactionColumns+" FROM transactions WHERE user_id = $1 AND parsed = false AND (duplicate_of IS NULL OR duplicate_status = 'rejected')", userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to get unparsed transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to reparse transactions"))
+		return
+	}
+
+	unparsed := []models.Transaction{}
+	for rows.Next() {
+		txn, err := scanTransaction(rows)
+		if err != nil {
+			logger.Log.Errorw("Failed to scan transaction", "error", err)
+			continue
+		}
+		unparsed = append(unparsed, txn)
+	}
+	rows.Close()
+
+	resp := models.ReparseTransactionsResponse{Checked: len(unparsed)}
+	for _, txn := range unparsed {
+		applyParseResult(&txn, parser.ParseWith(txn.RawText, txn.SenderInfo, templates))
+		if !txn.Parsed {
+			continue
+		}
+
+		if err := saveReparsed(userID, &txn); err != nil {
+			logger.Log.Errorw("Failed to update reparsed transaction", "error", err, "transactionId", txn.ID)
+			continue
+		}
+		resp.Parsed++
+		if txn.IsDuplicate() {
+			resp.Duplicates++
+		}
+
+		promoteTransaction(userID, &txn)
+	}
+
+	logger.Log.Infow("Transactions reparsed", "userId", userID, "checked", resp.Checked, "parsed", resp.Parsed, "duplicates", resp.Duplicates)
+	c.JSON(http.StatusOK, models.NewSuccessResponse(resp))
+}
+
+// saveReparsed stores the newly parsed fields of a transaction. The amount and reference
+// number it now has may match a transaction already stored, so unless it is already linked
+// or a user rejected its link, the duplicate check runs again under the same per-user lock
+// as ingestion.
+func saveReparsed(userID uuid.UUID, txn *models.Transaction) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", userID.String()); err != nil {
+		return err
+	}
+
+	if txn.DuplicateOf == nil {
+		match, err := dedup.FindOriginal(tx, dedup.Candidate{
+			ID:              txn.ID,
+			UserID:          userID,
+			DeviceID:        txn.DeviceID,
+			Timestamp:       txn.Timestamp,
+			Amount:          txn.Amount,
+			AccountLast4:    txn.AccountLast4,
+			Direction:       txn.Direction,
+			ReferenceNumber: txn.ReferenceNumber,
+			Fingerprint:     txn.Fingerprint,
+		}, config.AppConfig.Ingestion.DuplicateWindow)
+		if err != nil {
+			return err
+		}
+		if match != nil {
+			txn.DuplicateOf = &match.OriginalID
+			txn.DuplicateStatus = models.DuplicateStatusLinked
+			txn.DuplicateReason = match.Reason
+		}
+	}
+
+	txn.MerchantID, err = merchant.Resolve(tx, userID, txn.MerchantName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE transactions
+		SET amount = $1, merchant_name = $2, merchant_id = $3, account_last4 = $4, bank = $5, direction = $6, reference_number = $7, parse_template = $8, parsed = $9,
+			duplicate_of = $10, duplicate_status = $11, duplicate_reason = $12, updated_at = $13
+		WHERE id = $14
+	`, txn.Amount, nullString(txn.MerchantName), txn.MerchantID, nullString(txn.AccountLast4), nullString(txn.Bank), nullString(txn.Direction), nullString(txn.ReferenceNumber), nullString(txn.ParseTemplate), true,
+		txn.DuplicateOf, nullString(txn.DuplicateStatus), nullString(txn.DuplicateReason), time.Now(), txn.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ProcessTransactions promotes all of the user's parsed, unprocessed transactions into expenses
+func ProcessTransactions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	results, err := processor.ProcessPending(userID)
+	if err != nil {
+		logger.Log.Errorw("Failed to process transactions", "error", err, "userId", userID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to process transactions"))
+		return
+	}
+
+	logger.Log.Infow("Pending transactions processed", "userId", userID, "count", len(results))
+	c.JSON(http.StatusOK, models.NewSuccessResponse(results))
+}
+
+// ProcessTransaction promotes a single transaction into an expense. Safe to call repeatedly.
+func ProcessTransaction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(models.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrCodeInvalidInput, "Invalid transaction ID"))
+		return
+	}
+
+	result, err := processor.Process(userID, transactionID)
+	if err == processor.ErrTransactionNotFound {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrCodeNotFound, "Transaction not found"))
+		return
+	}
+	if err != nil {
+		logger.Log.Errorw("Failed to process transaction", "error", err, "transactionId", transactionID)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrCodeDatabaseError, "Failed to process transaction"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(result))
+}
+
+// promoteTransaction runs the processing pipeline on a freshly stored transaction.
+// Failures are logged rather than returned so ingestion never loses the raw data.
+func promoteTransaction(userID uuid.UUID, txn *models.Transaction) {
+	if !txn.Parsed || txn.IsDuplicate() {
+		return
+	}
+
+	result, err := processor.Process(userID, txn.ID)
+	if err != nil {
+		logger.Log.Warnw("Failed to process transaction", "error", err, "transactionId", txn.ID)
+		return
+	}
+	switch result.Status {
+	case models.ProcessStatusCreated:
+		txn.Processed = true
+		txn.ExpenseID = result.ExpenseID
+		txn.IncomeID = result.IncomeID
+	case models.ProcessStatusUnassigned:
+		txn.UnassignedReason = result.Reason
+	}
+}
+
+// validateTransaction checks a batch item, returning a message describing the first problem found
+func validateTransaction(txn models.Transaction) string {
+	if strings.TrimSpace(txn.RawText) == "" {
+		return "rawText is required"
+	}
+	if txn.Timestamp.IsZero() {
+		return "timestamp is required"
+	}
+	if txn.Amount != nil && *txn.Amount <= 0 {
+		return "amount must be greater than 0"
+	}
+	if txn.AccountLast4 != "" && (len(txn.AccountLast4) != 4 || strings.Trim(txn.AccountLast4, "0123456789") != "") {
+		return "accountLast4 must be 4 digits"
+	}
+	if txn.Direction != "" && txn.Direction != parser.DirectionDebit && txn.Direction != parser.DirectionCredit {
+		return "direction must be debit or credit"
+	}
+	return ""
+}
+
+// storeTransaction saves a raw transaction in its own database transaction. Inserts for
+// the same user are serialised so two devices uploading the same message at once
+// cannot both miss each other in the duplicate check.
+func storeTransaction(userID uuid.UUID, txn models.Transaction, templates []*parser.Template) (models.Transaction, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", userID.String()); err != nil {
+		return models.Transaction{}, err
+	}
+
+	saved, err := insertTransaction(tx, userID, txn, templates)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Transaction{}, err
+	}
+	return saved, nil
+}
+
+// insertTransaction parses and saves a raw transaction for the user and returns the stored row.
+// The user's templates are tried before the built-in ones. A transaction matching one already
+// stored is saved linked to it so it can be reviewed rather than turned into a second expense.
+func insertTransaction(q dbExecutor, userID uuid.UUID, txn models.Transaction, templates []*parser.Template) (models.Transaction, error) {
+	applyParseResult(&txn, parser.ParseWith(txn.RawText, txn.SenderInfo, templates))
+	txn.Fingerprint = dedup.Fingerprint(txn.RawText)
+
+	match, err := dedup.FindOriginal(q, dedup.Candidate{
+		UserID:          userID,
+		DeviceID:        txn.DeviceID,
+		Timestamp:       txn.Timestamp,
+		Amount:          txn.Amount,
+		AccountLast4:    txn.AccountLast4,
+		Direction:       txn.Direction,
+		ReferenceNumber: txn.ReferenceNumber,
+		Fingerprint:     txn.Fingerprint,
+	}, config.AppConfig.Ingestion.DuplicateWindow)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if match != nil {
+		txn.DuplicateOf = &match.OriginalID
+		txn.DuplicateStatus = models.DuplicateStatusLinked
+		txn.DuplicateReason = match.Reason
+	}
+
+	txn.MerchantID, err = merchant.Resolve(q, userID, txn.MerchantName)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	txn.LocationID, err = location.Nearest(q, userID, txn.Timestamp, locationLimits())
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	return scanTransaction(q.QueryRow(`
+		INSERT INTO transactions (user_id, raw_text, timestamp, sender_info, amount, merchant_name, merchant_id, account_last4, bank, direction, reference_number, parse_template, parsed, processed,
+			device_id, location_id, fingerprint, duplicate_of, duplicate_status, duplicate_reason, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $21)
+		RETURNING `+transactionColumns,
+		userID, txn.RawText, txn.Timestamp, nullString(txn.SenderInfo), txn.Amount, nullString(txn.MerchantName), txn.MerchantID, nullString(txn.AccountLast4), nullString(txn.Bank),
+		nullString(txn.Direction), nullString(txn.ReferenceNumber), nullString(txn.ParseTemplate), txn.Parsed, false,
+		nullString(txn.DeviceID), txn.LocationID, txn.Fingerprint, txn.DuplicateOf, nullString(txn.DuplicateStatus), nullString(txn.DuplicateReason), time.Now(),
+	))
+}
+
+// applyParseResult fills in fields the client left empty from the parser output.
+// A transaction counts as parsed once its amount is known.
+func applyParseResult(txn *models.Transaction, result *parser.Result) {
+	if result != nil {
+		txn.ParseTemplate = result.Template
+		txn.Bank = result.Bank
+		if txn.Amount == nil {
+			amount := result.Amount
+			txn.Amount = &amount
+		}
+		if txn.MerchantName == "" {
+			txn.MerchantName = result.MerchantName
+		}
+		if txn.AccountLast4 == "" {
+			txn.AccountLast4 = result.AccountLast4
+		}
+		if txn.Direction == "" {
+			txn.Direction = result.Direction
+		}
+		if txn.ReferenceNumber == "" {
+			txn.ReferenceNumber = result.ReferenceNumber
+		}
+	}
+	txn.Parsed = txn.Amount != nil
+}
+
+// scanTransaction reads a row selected with transactionColumns
+func scanTransaction(row rowScanner) (models.Transaction, error) {
+	var txn models.Transaction
+	var senderInfo, merchantName, accountLast4, bank, direction, referenceNumber, parseTemplate sql.NullString
+	var deviceID, fingerprint, duplicateStatus, duplicateReason, unassignedReason sql.NullString
+	err := row.Scan(&txn.ID, &txn.UserID, &txn.RawText, &txn.Timestamp, &senderInfo, &txn.Amount, &merchantName, &txn.MerchantID, &accountLast4, &bank,
+		&direction, &referenceNumber, &parseTemplate, &txn.Parsed, &txn.Processed, &txn.ExpenseID, &txn.IncomeID,
+		&deviceID, &txn.LocationID, &fingerprint, &txn.DuplicateOf, &duplicateStatus, &duplicateReason, &unassignedReason, &txn.CreatedAt, &txn.UpdatedAt)
+	txn.SenderInfo = senderInfo.String
+	txn.MerchantName = merchantName.String
+	txn.AccountLast4 = accountLast4.String
+	txn.Bank = bank.String
+	txn.Direction = direction.String
+	txn.ReferenceNumber = referenceNumber.String
+	txn.ParseTemplate = parseTemplate.String
+	txn.DeviceID = deviceID.String
+	txn.Fingerprint = fingerprint.String
+	txn.DuplicateStatus = duplicateStatus.String
+	txn.DuplicateReason = duplicateReason.String
+	txn.UnassignedReason = unassignedReason.String
+	return txn, err
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// parseDateParam accepts either an RFC 3339 timestamp or a YYYY-MM-DD date
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -58,6 +58,8 @@ func SetupRouter() *gin.Engine {
 			protected.DELETE("/accounts/:id", handlers.DeleteAccount)
 			protected.GET("/accounts/summary", handlers.GetAccountSummary)
 			protected.GET("/accounts/:id/expenses", handlers.GetAccountExpenses)
+			protected.POST("/accounts/:id/identifiers", handlers.CreateAccountIdentifier)
+			protected.DELETE("/accounts/:id/identifiers/:identifierId", handlers.DeleteAccountIdentifier)
 
 			// Expenses
 			protected.GET("/expenses", handlers.GetExpenses)
@@ -65,18 +67,83 @@ func SetupRouter() *gin.Engine {
 			protected.PUT("/expenses/:id", handlers.UpdateExpense)
 			protected.DELETE("/expenses/:id", handlers.DeleteExpense)
 
+			// Incomes
+			protected.GET("/incomes", handlers.GetIncomes)
+			protected.POST("/incomes", handlers.CreateIncome)
+			protected.PUT("/incomes/:id", handlers.UpdateIncome)
+			protected.DELETE("/incomes/:id", handlers.DeleteIncome)
+
+			// Merchants
+			protected.GET("/merchants", handlers.GetMerchants)
+			protected.POST("/merchants", handlers.CreateMerchant)
+			protected.GET("/merchants/unresolved", handlers.GetUnresolvedMerchantNames)
+			protected.POST("/merchants/:id/aliases", handlers.AddMerchantAlias)
+			protected.POST("/merchants/:id/merge", handlers.MergeMerchant)
+			protected.POST("/merchants/:id/split", handlers.SplitMerchant)
+			protected.GET("/merchants/:id/expenses", handlers.GetMerchantExpenses)
+
 			// Merchant Patterns
 			protected.GET("/merchant-patterns", handlers.GetMerchantPatterns)
+			protected.GET("/merchant-patterns/conflicts", handlers.GetMerchantPatternConflicts)
+			protected.GET("/merchant-patterns/stats", handlers.GetMerchantPatternStats)
+			protected.GET("/merchant-patterns/export", handlers.ExportMerchantPatterns)
+			protected.POST("/merchant-patterns/import", handlers.ImportMerchantPatterns)
+			protected.GET("/merchant-patterns/suggestions", handlers.GetMerchantPatternSuggestions)
+			protected.POST("/merchant-patterns/suggestions/accept", handlers.AcceptMerchantPatternSuggestions)
 			protected.POST("/merchant-patterns", handlers.CreateMerchantPattern)
 			protected.PUT("/merchant-patterns/:id", handlers.UpdateMerchantPattern)
 			protected.DELETE("/merchant-patterns/:id", handlers.DeleteMerchantPattern)
+			protected.POST("/merchant-patterns/:id/apply", handlers.ApplyMerchantPattern)
 			protected.POST("/merchant-patterns/match", handlers.MatchMerchantPattern)
+			protected.POST("/merchant-patterns/match/batch", handlers.MatchMerchantPatternBatch)
+
+			// Rules
+			protected.GET("/rules", handlers.GetRules)
+			protected.POST("/rules", handlers.CreateRule)
+			protected.PUT("/rules/order", handlers.ReorderRules)
+			protected.PUT("/rules/:id", handlers.UpdateRule)
+			protected.DELETE("/rules/:id", handlers.DeleteRule)
+			protected.POST("/rules/test", handlers.TestRules)
+
+			// Transactions
+			protected.GET("/transactions", handlers.GetTransactions)
+			protected.POST("/transactions", handlers.CreateTransaction)
+			protected.POST("/transactions/batch", handlers.BatchCreateTransactions)
+			protected.GET("/transactions/unparsed", handlers.GetUnparsedTransactionSummary)
+			protected.POST("/transactions/reparse", handlers.ReparseTransactions)
+			protected.POST("/transactions/process", handlers.ProcessTransactions)
+			protected.POST("/transactions/:id/process", handlers.ProcessTransaction)
+			protected.GET("/transactions/unassigned", handlers.GetUnassignedTransactions)
+			protected.POST("/transactions/:id/assign", handlers.AssignTransaction)
+			protected.POST("/transactions/:id/dismiss", handlers.DismissTransaction)
+			protected.GET("/transactions/duplicates", handlers.GetDuplicateTransactions)
+			protected.POST("/transactions/duplicates/:id/confirm", handlers.ConfirmDuplicateTransaction)
+			protected.POST("/transactions/duplicates/:id/undo", handlers.UndoDuplicateTransaction)
+
+			// Parser Templates
+			protected.GET("/parser-templates", handlers.GetParserTemplates)
+			protected.POST("/parser-templates", handlers.CreateParserTemplate)
+			protected.PUT("/parser-templates/:id", handlers.UpdateParserTemplate)
+			protected.DELETE("/parser-templates/:id", handlers.DeleteParserTemplate)
+			protected.POST("/parser-templates/test", handlers.TestParserTemplate)
+
+			// Locations
+			protected.POST("/locations", handlers.CreateLocation)
+			protected.POST("/locations/batch", handlers.BatchCreateLocations)
+			protected.GET("/locations/export", handlers.ExportLocations)
+			protected.GET("/locations/:id/expenses", handlers.GetLocationExpenses)
+
+			// Places
+			protected.GET("/places", handlers.GetPlaces)
+			protected.POST("/places/rebuild", handlers.RebuildPlaces)
+			protected.PUT("/places/:id", handlers.UpdatePlace)
+			protected.GET("/places/:id/expenses", handlers.GetPlaceExpenses)
+
+			// Sync
+			protected.POST("/sync/incremental", handlers.IncrementalSync)
+			protected.GET("/changes", handlers.GetChanges)
 
 			// TODO: Add remaining endpoints as needed
-			// - Transactions
-			// - Merchants
-			// - Locations
-			// - Sync operations
 		}
 	}
 
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/config"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/geocode"
+	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backfillGazetteer string
+	backfillBatchSize int
+	backfillAll       bool
+)
+
+var backfillAddressesCmd = &cobra.Command{
+	Use:   "backfill-addresses",
+	Short: "Fill in addresses of stored locations from the gazetteer",
+	Long: `Look up the address of every stored location fix that has none in the
+gazetteer set by GAZETTEER_PATH or --gazetteer. Fixes recorded before a
+gazetteer was configured are otherwise never geocoded. Use --all to look up
+every fix again after switching to a more detailed gazetteer.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := config.LoadConfig(); err != nil {
+			logger.Log.Fatalw("Failed to load configuration", "error", err)
+		}
+
+		path := backfillGazetteer
+		if path == "" {
+			path = config.AppConfig.Location.GazetteerPath
+		}
+		if path == "" {
+			logger.Log.Fatal("No gazetteer configured; set GAZETTEER_PATH or pass --gazetteer")
+		}
+		if backfillBatchSize < 1 {
+			logger.Log.Fatalw("Invalid batch size", "batch", backfillBatchSize)
+		}
+
+		index, err := geocode.LoadFile(path)
+		if err != nil {
+			logger.Log.Fatalw("Failed to load gazetteer", "error", err, "path", path)
+		}
+		logger.Log.Infow("Gazetteer loaded", "path", path, "entries", index.Len())
+
+		if _, err := db.InitDB(config.AppConfig.GetDatabaseDSN()); err != nil {
+			logger.Log.Fatalw("Failed to initialize database", "error", err)
+		}
+		defer db.Close()
+
+		scanned, updated, err := backfillAddresses(index, backfillBatchSize, backfillAll)
+		if err != nil {
+			logger.Log.Fatalw("Failed to backfill addresses", "error", err, "scanned", scanned, "updated", updated)
+		}
+		logger.Log.Infow("Addresses backfilled", "scanned", scanned, "updated", updated)
+	},
+}
+
+type addressFix struct {
+	id        uuid.UUID
+	latitude  float64
+	longitude float64
+}
+
+// backfillAddresses geocodes locations batch by batch in id order, so fixes
+// the gazetteer has nothing near are passed over rather than fetched again
+func backfillAddresses(index *geocode.Index, batchSize int, all bool) (int, int, error) {
+	where := "address IS NULL AND id > $1"
+	if all {
+		where = "id > $1"
+	}
+
+	scanned, updated := 0, 0
+	var after uuid.UUID
+	for {
+		rows, err := db.DB.Query("SELECT id, latitude, longitude FROM locations WHERE "+where+" ORDER BY id LIMIT $2", after, batchSize)
+		if err != nil {
+			return scanned, updated, err
+		}
+		fixes := []addressFix{}
+		for rows.Next() {
+			var f addressFix
+			if err := rows.Scan(&f.id, &f.latitude, &f.longitude); err != nil {
+				rows.Close()
+				return scanned, updated, err
+			}
+			fixes = append(fixes, f)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return scanned, updated, err
+		}
+		if len(fixes) == 0 {
+			return scanned, updated, nil
+		}
+
+		for _, f := range fixes {
+			address := index.Address(f.latitude, f.longitude)
+			if address == "" {
+				continue
+			}
+			if _, err := db.DB.Exec("UPDATE locations SET address = $1 WHERE id = $2", address, f.id); err != nil {
+				return scanned, updated, err
+			}
+			updated++
+		}
+		scanned += len(fixes)
+		after = fixes[len(fixes)-1].id
+		logger.Log.Infow("Batch geocoded", "scanned", scanned, "updated", updated)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(backfillAddressesCmd)
+
+	backfillAddressesCmd.Flags().StringVar(&backfillGazetteer, "gazetteer", "", "gazetteer file to use instead of GAZETTEER_PATH")
+	backfillAddressesCmd.Flags().IntVar(&backfillBatchSize, "batch", 500, "number of locations to read at a time")
+	backfillAddressesCmd.Flags().BoolVar(&backfillAll, "all", false, "look up locations that already have an address too")
+}
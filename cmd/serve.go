@@ -12,7 +12,9 @@ import (
 	"github.com/sooraj1002/expense-tracker/api"
 	"github.com/sooraj1002/expense-tracker/config"
 	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/geocode"
 	"github.com/sooraj1002/expense-tracker/logger"
+	"github.com/sooraj1002/expense-tracker/merchant"
 )
 
 var serveCmd = &cobra.Command{
@@ -43,6 +45,25 @@ var serveCmd = &cobra.Command{
 			logger.Log.Fatalw("Failed to run migrations", "error", err)
 		}
 
+		// Fill in merchant lookup keys the migrations could not compute
+		filled, err := merchant.BackfillKeys(dbConn)
+		if err != nil {
+			logger.Log.Fatalw("Failed to backfill merchant keys", "error", err)
+		}
+		if filled > 0 {
+			logger.Log.Infow("Merchant keys backfilled", "merchants", filled)
+		}
+
+		// Load the gazetteer for reverse geocoding
+		if path := config.AppConfig.Location.GazetteerPath; path != "" {
+			index, err := geocode.LoadFile(path)
+			if err != nil {
+				logger.Log.Fatalw("Failed to load gazetteer", "error", err, "path", path)
+			}
+			geocode.Default = index
+			logger.Log.Infow("Gazetteer loaded", "path", path, "entries", index.Len())
+		}
+
 		// Setup router
 		router := api.SetupRouter()
 
@@ -10,9 +10,11 @@ import (
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	JWT      JWTConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	JWT       JWTConfig
+	Ingestion IngestionConfig
+	Location  LocationConfig
 }
 
 type DatabaseConfig struct {
@@ -34,6 +36,25 @@ type JWTConfig struct {
 	Expiry time.Duration
 }
 
+type IngestionConfig struct {
+	DuplicateWindow time.Duration
+}
+
+type LocationConfig struct {
+	// LinkWindow is how far in time a location fix may be from an expense or
+	// transaction and still be linked to it
+	LinkWindow time.Duration
+	// MaxAccuracy is the largest accuracy radius in metres a fix may have to
+	// be linked; 0 accepts any
+	MaxAccuracy float64
+	// PlaceRadius is how far in metres a fix may be from the centre of a
+	// place and still be grouped into it
+	PlaceRadius float64
+	// GazetteerPath is the GeoNames-format file addresses are looked up in;
+	// empty leaves addresses unset
+	GazetteerPath string
+}
+
 var AppConfig *Config
 
 // LoadConfig loads configuration from environment variables
@@ -51,6 +72,26 @@ func LoadConfig() error {
 		return fmt.Errorf("invalid JWT_EXPIRY: %w", err)
 	}
 
+	duplicateWindow, err := time.ParseDuration(getEnv("DUPLICATE_WINDOW", "10m"))
+	if err != nil {
+		return fmt.Errorf("invalid DUPLICATE_WINDOW: %w", err)
+	}
+
+	locationLinkWindow, err := time.ParseDuration(getEnv("LOCATION_LINK_WINDOW", "15m"))
+	if err != nil {
+		return fmt.Errorf("invalid LOCATION_LINK_WINDOW: %w", err)
+	}
+
+	locationMaxAccuracy, err := strconv.ParseFloat(getEnv("LOCATION_MAX_ACCURACY", "200"), 64)
+	if err != nil || locationMaxAccuracy < 0 {
+		return fmt.Errorf("invalid LOCATION_MAX_ACCURACY: %q", getEnv("LOCATION_MAX_ACCURACY", "200"))
+	}
+
+	placeRadius, err := strconv.ParseFloat(getEnv("PLACE_RADIUS", "150"), 64)
+	if err != nil || placeRadius <= 0 {
+		return fmt.Errorf("invalid PLACE_RADIUS: %q", getEnv("PLACE_RADIUS", "150"))
+	}
+
 	AppConfig = &Config{
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -68,6 +109,15 @@ func LoadConfig() error {
 			Secret: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
 			Expiry: jwtExpiry,
 		},
+		Ingestion: IngestionConfig{
+			DuplicateWindow: duplicateWindow,
+		},
+		Location: LocationConfig{
+			LinkWindow:    locationLinkWindow,
+			MaxAccuracy:   locationMaxAccuracy,
+			PlaceRadius:   placeRadius,
+			GazetteerPath: getEnv("GAZETTEER_PATH", ""),
+		},
 	}
 
 	return nil
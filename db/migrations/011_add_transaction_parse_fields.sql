@@ -0,0 +1,9 @@
+-- Add fields extracted by the server-side notification parser
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS direction VARCHAR(10);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reference_number VARCHAR(64);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS parse_template VARCHAR(100);
+
+ALTER TABLE transactions ADD CONSTRAINT check_direction CHECK (direction IN ('debit', 'credit'));
+
+CREATE INDEX idx_transactions_parsed ON transactions(parsed);
+CREATE INDEX idx_transactions_reference_number ON transactions(reference_number);
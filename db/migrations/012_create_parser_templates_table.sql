@@ -0,0 +1,17 @@
+-- Create parser_templates table
+CREATE TABLE IF NOT EXISTS parser_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    sender_match VARCHAR(255),
+    pattern TEXT NOT NULL,
+    direction VARCHAR(10) NOT NULL DEFAULT 'debit',
+    priority INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_parser_template_direction CHECK (direction IN ('debit', 'credit')),
+    UNIQUE(user_id, name)
+);
+
+CREATE INDEX idx_parser_templates_user_id ON parser_templates(user_id);
@@ -0,0 +1,4 @@
+-- Add last 4 digits of the account/card number so parsed transactions can be matched to accounts
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS account_last4 VARCHAR(4);
+
+CREATE INDEX idx_accounts_account_last4 ON accounts(user_id, account_last4);
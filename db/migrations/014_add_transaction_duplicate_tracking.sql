@@ -0,0 +1,11 @@
+-- Track which device sent each transaction and link cross-device duplicates to the original
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS device_id VARCHAR(255);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(64);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS duplicate_of UUID REFERENCES transactions(id) ON DELETE SET NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS duplicate_status VARCHAR(20);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS duplicate_reason VARCHAR(50);
+
+ALTER TABLE transactions ADD CONSTRAINT check_duplicate_status CHECK (duplicate_status IN ('linked', 'confirmed', 'rejected'));
+
+CREATE INDEX idx_transactions_fingerprint ON transactions(user_id, fingerprint);
+CREATE INDEX idx_transactions_duplicate_of ON transactions(duplicate_of);
@@ -0,0 +1,42 @@
+-- Split categories into expense and income categories
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS type VARCHAR(10) NOT NULL DEFAULT 'expense';
+ALTER TABLE categories ADD CONSTRAINT check_category_type CHECK (type IN ('expense', 'income'));
+
+CREATE INDEX idx_categories_type ON categories(type);
+
+-- Insert default income categories
+INSERT INTO categories (id, user_id, name, color, is_default, type) VALUES
+    ('a1111111-1111-1111-1111-111111111111', NULL, 'Salary', '#388E3C', TRUE, 'income'),
+    ('a2222222-2222-2222-2222-222222222222', NULL, 'Refunds', '#0288D1', TRUE, 'income'),
+    ('a3333333-3333-3333-3333-333333333333', NULL, 'Interest', '#7B1FA2', TRUE, 'income'),
+    ('a4444444-4444-4444-4444-444444444444', NULL, 'Transfers In', '#455A64', TRUE, 'income'),
+    ('a9999999-9999-9999-9999-999999999999', NULL, 'Other Income', '#757575', TRUE, 'income');
+
+-- Track money coming into each account
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS total_income DECIMAL(12, 2) NOT NULL DEFAULT 0;
+
+-- Create incomes table
+CREATE TABLE IF NOT EXISTS incomes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount DECIMAL(12, 2) NOT NULL,
+    category_id UUID NOT NULL REFERENCES categories(id),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    date TIMESTAMP NOT NULL,
+    description TEXT,
+    source VARCHAR(20) DEFAULT 'manual',
+    payer_name VARCHAR(255),
+    raw_data TEXT,
+    verified BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_income_source CHECK (source IN ('manual', 'auto'))
+);
+
+CREATE INDEX idx_incomes_user_id ON incomes(user_id);
+CREATE INDEX idx_incomes_category_id ON incomes(category_id);
+CREATE INDEX idx_incomes_account_id ON incomes(account_id);
+CREATE INDEX idx_incomes_date ON incomes(date);
+
+-- Credit transactions are promoted into incomes
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS income_id UUID REFERENCES incomes(id) ON DELETE SET NULL;
@@ -0,0 +1,27 @@
+-- Instrument identifiers used to route parsed transactions to accounts
+CREATE TABLE IF NOT EXISTS account_identifiers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_identifier_type CHECK (type IN ('last4', 'upi_vpa', 'issuer')),
+    CONSTRAINT unique_account_identifier UNIQUE (account_id, type, value)
+);
+
+CREATE INDEX idx_account_identifiers_user_id ON account_identifiers(user_id);
+CREATE INDEX idx_account_identifiers_account_id ON account_identifiers(account_id);
+
+-- Move the single last-4 column into the identifiers table
+INSERT INTO account_identifiers (user_id, account_id, type, value)
+SELECT user_id, id, 'last4', account_last4 FROM accounts WHERE account_last4 IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_accounts_account_last4;
+ALTER TABLE accounts DROP COLUMN IF EXISTS account_last4;
+
+-- Remember the issuing bank of parsed transactions and why the resolver could not place them
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS bank VARCHAR(50);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS unassigned_reason VARCHAR(255);
+
+CREATE INDEX idx_transactions_unassigned ON transactions(user_id) WHERE unassigned_reason IS NOT NULL;
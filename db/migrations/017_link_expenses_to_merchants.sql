@@ -0,0 +1,23 @@
+-- Create merchants for expenses recorded before merchant tracking existed
+INSERT INTO merchant_info (user_id, name, aliases)
+SELECT DISTINCT user_id, TRIM(merchant_name), '{}'::TEXT[]
+FROM expenses
+WHERE merchant_name IS NOT NULL AND TRIM(merchant_name) <> ''
+ON CONFLICT (user_id, name) DO NOTHING;
+
+UPDATE expenses e SET merchant_id = m.id
+FROM merchant_info m
+WHERE e.merchant_id IS NULL AND m.user_id = e.user_id AND m.name = TRIM(e.merchant_name);
+
+UPDATE merchant_info m SET
+    transaction_count = (SELECT COUNT(*) FROM expenses WHERE merchant_id = m.id),
+    total_spent = (SELECT COALESCE(SUM(amount), 0) FROM expenses WHERE merchant_id = m.id),
+    common_category_id = (
+        SELECT category_id FROM expenses WHERE merchant_id = m.id
+        GROUP BY category_id
+        ORDER BY COUNT(*) DESC, MAX(date) DESC
+        LIMIT 1
+    );
+
+ALTER TABLE expenses ADD CONSTRAINT fk_expenses_merchant
+    FOREIGN KEY (merchant_id) REFERENCES merchant_info(id) ON DELETE SET NULL;
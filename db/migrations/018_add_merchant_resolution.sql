@@ -0,0 +1,9 @@
+-- Distinguish merchants created from raw bank names from ones the user curated.
+-- Existing merchants without aliases have only ever been created from expenses.
+ALTER TABLE merchant_info ADD COLUMN IF NOT EXISTS auto_created BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE merchant_info SET auto_created = TRUE WHERE aliases IS NULL OR aliases = '{}';
+
+-- Merchant a raw transaction resolves to, if any
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS merchant_id UUID REFERENCES merchant_info(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_transactions_merchant_id ON transactions(merchant_id);
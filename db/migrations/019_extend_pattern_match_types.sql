@@ -0,0 +1,4 @@
+-- Allow prefix, suffix, whole-word and regex merchant patterns
+ALTER TABLE merchant_patterns DROP CONSTRAINT IF EXISTS check_match_type;
+ALTER TABLE merchant_patterns ADD CONSTRAINT check_match_type
+    CHECK (match_type IN ('exact', 'contains', 'starts_with', 'ends_with', 'word', 'regex'));
@@ -0,0 +1,4 @@
+-- Explicit precedence between merchant patterns that match the same name
+ALTER TABLE merchant_patterns ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_merchant_patterns_priority ON merchant_patterns(user_id, priority DESC);
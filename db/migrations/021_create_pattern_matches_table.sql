@@ -0,0 +1,17 @@
+-- One row per time a merchant pattern matched, used for pattern effectiveness stats
+-- category_id is the category the pattern assigned at the time and is kept without a
+-- foreign key so the history does not block deleting a category later
+CREATE TABLE IF NOT EXISTS pattern_matches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pattern_id UUID NOT NULL REFERENCES merchant_patterns(id) ON DELETE CASCADE,
+    expense_id UUID REFERENCES expenses(id) ON DELETE SET NULL,
+    category_id UUID NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    matched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_pattern_match_source CHECK (source IN ('match', 'auto'))
+);
+
+CREATE INDEX idx_pattern_matches_pattern_id ON pattern_matches(pattern_id, matched_at);
+CREATE INDEX idx_pattern_matches_user_id ON pattern_matches(user_id, matched_at);
+CREATE INDEX idx_pattern_matches_expense_id ON pattern_matches(expense_id);
@@ -0,0 +1,36 @@
+-- Categorisation rules that run in order when an expense is created or ingested.
+-- Every condition column is optional and all set conditions must hold; at least
+-- one action column must be set.
+CREATE TABLE IF NOT EXISTS rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    stop_processing BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- Conditions
+    merchant_name VARCHAR(255),
+    merchant_match_type VARCHAR(20),
+    min_amount DECIMAL(12, 2),
+    max_amount DECIMAL(12, 2),
+    account_id UUID REFERENCES accounts(id) ON DELETE CASCADE,
+    days_of_week INTEGER[],
+    source VARCHAR(20),
+    description_keywords TEXT[],
+
+    -- Actions
+    set_category_id UUID REFERENCES categories(id),
+    set_description TEXT,
+    set_verified BOOLEAN,
+
+    use_count INTEGER NOT NULL DEFAULT 0,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_rule_merchant_match_type CHECK (merchant_match_type IN ('exact', 'contains', 'starts_with', 'ends_with', 'word', 'regex')),
+    CONSTRAINT check_rule_source CHECK (source IN ('manual', 'auto')),
+    CONSTRAINT check_rule_action CHECK (set_category_id IS NOT NULL OR set_description IS NOT NULL OR set_verified IS NOT NULL)
+);
+
+CREATE INDEX idx_rules_user_id ON rules(user_id, position);
@@ -0,0 +1,10 @@
+-- Fuzzy merchant patterns match names that are similar rather than equal,
+-- catching typos and truncation in bank messages
+ALTER TABLE merchant_patterns DROP CONSTRAINT IF EXISTS check_match_type;
+ALTER TABLE merchant_patterns ADD CONSTRAINT check_match_type
+    CHECK (match_type IN ('exact', 'contains', 'starts_with', 'ends_with', 'word', 'regex', 'fuzzy'));
+
+-- Similarity from 0 to 1 a fuzzy pattern needs to match; NULL uses the default
+ALTER TABLE merchant_patterns ADD COLUMN IF NOT EXISTS fuzzy_threshold REAL;
+ALTER TABLE merchant_patterns ADD CONSTRAINT check_fuzzy_threshold
+    CHECK (fuzzy_threshold IS NULL OR (fuzzy_threshold > 0 AND fuzzy_threshold <= 1));
@@ -0,0 +1,6 @@
+-- Link bank transactions to the location fix nearest in time, as expenses already can be
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS location_id UUID REFERENCES locations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_locations_user_timestamp ON locations(user_id, timestamp);
+CREATE INDEX idx_expenses_location_id ON expenses(location_id);
+CREATE INDEX idx_transactions_location_id ON transactions(location_id);
@@ -0,0 +1,20 @@
+-- Places are clusters of a user's location fixes, such as a mall or an office
+CREATE TABLE IF NOT EXISTS places (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    -- Distance in metres from the centre to the farthest fix
+    radius DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fix_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_places_user_position ON places(user_id, latitude, longitude);
+
+-- Expenses belong to the place of the fix they are linked to
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS place_id UUID REFERENCES places(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_locations_place_id ON locations(place_id);
@@ -0,0 +1,22 @@
+-- Track when transactions change, as expenses and patterns already do, so a sync can send
+-- devices everything changed since they last synced
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE transactions SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE transactions ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_transactions_user_updated_at ON transactions(user_id, updated_at);
+CREATE INDEX idx_expenses_user_updated_at ON expenses(user_id, updated_at);
+CREATE INDEX idx_merchant_patterns_user_updated_at ON merchant_patterns(user_id, updated_at);
+
+-- Server IDs given to records a device created offline under its own IDs, so a sync that is
+-- retried after a dropped response maps them again instead of creating them twice
+CREATE TABLE IF NOT EXISTS sync_id_mappings (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    entity_type VARCHAR(20) NOT NULL,
+    local_id VARCHAR(255) NOT NULL,
+    server_id UUID NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, device_id, entity_type, local_id),
+    CONSTRAINT check_sync_entity_type CHECK (entity_type IN ('transaction', 'expense', 'merchant_pattern'))
+);
@@ -0,0 +1,99 @@
+-- Every insert, update and delete of a user's records, numbered per user, so devices can
+-- page through what changed, deletions included, by sequence number
+CREATE TABLE IF NOT EXISTS change_log (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    entity_type VARCHAR(20) NOT NULL,
+    entity_id UUID NOT NULL,
+    operation VARCHAR(10) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, seq),
+    CONSTRAINT check_change_operation CHECK (operation IN ('insert', 'update', 'delete'))
+);
+
+-- Last sequence number given out to each user
+CREATE TABLE IF NOT EXISTS change_sequences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL
+);
+
+-- Records a row change in the change log. The triggers are deferred to commit, so the lock
+-- on the user's sequence row is held only while committing and a transaction that commits
+-- later always gets higher numbers: a device that has read up to a number never misses one
+-- below it. Rows deleted along with their user are not recorded.
+CREATE OR REPLACE FUNCTION record_change() RETURNS TRIGGER AS $$
+DECLARE
+    row_user_id UUID;
+    row_id UUID;
+    next_seq BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_user_id := OLD.user_id;
+        row_id := OLD.id;
+    ELSE
+        row_user_id := NEW.user_id;
+        row_id := NEW.id;
+    END IF;
+
+    IF row_user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE id = row_user_id) THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO change_sequences (user_id, last_seq) VALUES (row_user_id, 1)
+    ON CONFLICT (user_id) DO UPDATE SET last_seq = change_sequences.last_seq + 1
+    RETURNING last_seq INTO next_seq;
+
+    INSERT INTO change_log (user_id, seq, entity_type, entity_id, operation, changed_at)
+    VALUES (row_user_id, next_seq, TG_ARGV[0], row_id, lower(TG_OP), CURRENT_TIMESTAMP);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER accounts_change_log AFTER INSERT OR DELETE ON accounts
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION record_change('account');
+CREATE CONSTRAINT TRIGGER accounts_change_log_update AFTER UPDATE ON accounts
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*) EXECUTE FUNCTION record_change('account');
+
+CREATE CONSTRAINT TRIGGER categories_change_log AFTER INSERT OR DELETE ON categories
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION record_change('category');
+CREATE CONSTRAINT TRIGGER categories_change_log_update AFTER UPDATE ON categories
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*) EXECUTE FUNCTION record_change('category');
+
+CREATE CONSTRAINT TRIGGER expenses_change_log AFTER INSERT OR DELETE ON expenses
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION record_change('expense');
+CREATE CONSTRAINT TRIGGER expenses_change_log_update AFTER UPDATE ON expenses
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*) EXECUTE FUNCTION record_change('expense');
+
+CREATE CONSTRAINT TRIGGER incomes_change_log AFTER INSERT OR DELETE ON incomes
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION record_change('income');
+CREATE CONSTRAINT TRIGGER incomes_change_log_update AFTER UPDATE ON incomes
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*) EXECUTE FUNCTION record_change('income');
+
+CREATE CONSTRAINT TRIGGER transactions_change_log AFTER INSERT OR DELETE ON transactions
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION record_change('transaction');
+CREATE CONSTRAINT TRIGGER transactions_change_log_update AFTER UPDATE ON transactions
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*) EXECUTE FUNCTION record_change('transaction');
+
+CREATE CONSTRAINT TRIGGER merchant_patterns_change_log AFTER INSERT OR DELETE ON merchant_patterns
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION record_change('merchantPattern');
+-- Every match bumps a pattern's use_count and last_used_at, which are not changes to the pattern
+CREATE CONSTRAINT TRIGGER merchant_patterns_change_log_update AFTER UPDATE ON merchant_patterns
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW
+    WHEN ((OLD.merchant_name, OLD.category_id, OLD.match_type, OLD.priority, OLD.fuzzy_threshold, OLD.is_active)
+        IS DISTINCT FROM (NEW.merchant_name, NEW.category_id, NEW.match_type, NEW.priority, NEW.fuzzy_threshold, NEW.is_active))
+    EXECUTE FUNCTION record_change('merchantPattern');
+
+-- Start each user's log with the records they already have
+INSERT INTO change_log (user_id, seq, entity_type, entity_id, operation, changed_at)
+SELECT user_id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at, entity_type, id), entity_type, id, 'insert', created_at
+FROM (
+    SELECT user_id, id, 'account' AS entity_type, created_at FROM accounts
+    UNION ALL SELECT user_id, id, 'category', created_at FROM categories WHERE user_id IS NOT NULL
+    UNION ALL SELECT user_id, id, 'expense', created_at FROM expenses
+    UNION ALL SELECT user_id, id, 'income', created_at FROM incomes
+    UNION ALL SELECT user_id, id, 'transaction', created_at FROM transactions
+    UNION ALL SELECT user_id, id, 'merchantPattern', created_at FROM merchant_patterns
+) existing;
+
+INSERT INTO change_sequences (user_id, last_seq)
+SELECT user_id, MAX(seq) FROM change_log GROUP BY user_id;
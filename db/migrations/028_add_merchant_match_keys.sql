@@ -0,0 +1,7 @@
+-- Normalised keys of each merchant's name and aliases, so a raw name resolves to a
+-- merchant with one indexed lookup. The keys come from the server's merchant name
+-- normaliser, which fills in rows left NULL here when the server starts; setting the
+-- column back to NULL makes it recompute them after the normaliser changes.
+ALTER TABLE merchant_info ADD COLUMN IF NOT EXISTS match_keys TEXT[];
+
+CREATE INDEX idx_merchant_info_match_keys ON merchant_info USING GIN (match_keys);
@@ -0,0 +1,14 @@
+-- The version of each expense and merchant pattern a device last saved through a sync. A
+-- later change from that device to the same version is made on top of its own write, so it
+-- is not reported as a conflict even though the version is newer than the device's last sync.
+CREATE TABLE IF NOT EXISTS sync_writes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    entity_type VARCHAR(20) NOT NULL,
+    server_id UUID NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, device_id, entity_type, server_id),
+    CONSTRAINT check_sync_write_entity_type CHECK (entity_type IN ('expense', 'merchant_pattern'))
+);
+
+CREATE INDEX idx_sync_writes_server_id ON sync_writes(user_id, entity_type, server_id);
@@ -0,0 +1,134 @@
+// Package dedup detects the same bank message arriving more than once, for
+// example when a user has the app installed on two phones.
+package dedup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Reasons a transaction was linked to an original
+const (
+	ReasonReferenceNumber = "reference_number"
+	ReasonSameText        = "same_text"
+	ReasonCrossDevice     = "cross_device"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Candidate is an incoming transaction to check against the user's history
+type Candidate struct {
+	// ID is set when the candidate is already stored, so it is never matched against itself
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	DeviceID        string
+	Timestamp       time.Time
+	Amount          *float64
+	AccountLast4    string
+	Direction       string
+	ReferenceNumber string
+	Fingerprint     string
+}
+
+// Match identifies the original a candidate duplicates
+type Match struct {
+	OriginalID uuid.UUID
+	Reason     string
+}
+
+// Fingerprint hashes the message text after lowercasing and stripping
+// punctuation and whitespace differences
+func Fingerprint(rawText string) string {
+	normalized := strings.Join(strings.FieldsFunc(strings.ToLower(rawText), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindOriginal looks for an earlier transaction the candidate duplicates. Checks
+// run from strongest to weakest evidence:
+//  1. the same bank reference number and amount, at any time
+//  2. the same normalised text within the window, sent from a different device, or
+//     re-sent with the same timestamp. Identical messages from one device a few minutes
+//     apart are genuine repeat purchases when the bank leaves out reference numbers.
+//  3. the same amount, account digits and direction within the window, sent from a different device
+//
+// Transactions that are themselves duplicates are never used as originals, unless a user rejected the link.
+func FindOriginal(q Querier, c Candidate, window time.Duration) (*Match, error) {
+	if c.ReferenceNumber != "" && c.Amount != nil {
+		id, err := findOne(q, `
+			SELECT id FROM transactions
+			WHERE user_id = $1 AND reference_number = $2 AND amount = $3 AND id <> $4 AND (duplicate_of IS NULL OR duplicate_status = 'rejected')
+			ORDER BY timestamp ASC LIMIT 1
+		`, c.UserID, c.ReferenceNumber, *c.Amount, c.ID)
+		if err != nil || id != nil {
+			return matchOf(id, ReasonReferenceNumber), err
+		}
+	}
+
+	from, to := c.Timestamp.Add(-window), c.Timestamp.Add(window)
+
+	if c.Fingerprint != "" {
+		var deviceID interface{}
+		if c.DeviceID != "" {
+			deviceID = c.DeviceID
+		}
+		id, err := findOne(q, `
+			SELECT id FROM transactions
+			WHERE user_id = $1 AND fingerprint = $2 AND timestamp BETWEEN $3 AND $4
+				AND (device_id IS DISTINCT FROM $5 OR timestamp = $6) AND id <> $7
+				AND (duplicate_of IS NULL OR duplicate_status = 'rejected')
+			ORDER BY timestamp ASC LIMIT 1
+		`, c.UserID, c.Fingerprint, from, to, deviceID, c.Timestamp, c.ID)
+		if err != nil || id != nil {
+			return matchOf(id, ReasonSameText), err
+		}
+	}
+
+	if c.DeviceID != "" && c.Amount != nil && c.AccountLast4 != "" {
+		id, err := findOne(q, `
+			SELECT id FROM transactions
+			WHERE user_id = $1 AND amount = $2 AND account_last4 = $3 AND COALESCE(direction, '') = $4
+				AND device_id IS NOT NULL AND device_id <> $5
+				AND timestamp BETWEEN $6 AND $7 AND id <> $8 AND (duplicate_of IS NULL OR duplicate_status = 'rejected')
+			ORDER BY timestamp ASC LIMIT 1
+		`, c.UserID, *c.Amount, c.AccountLast4, c.Direction, c.DeviceID, from, to, c.ID)
+		if err != nil || id != nil {
+			return matchOf(id, ReasonCrossDevice), err
+		}
+	}
+
+	return nil, nil
+}
+
+// findOne returns the ID selected by the query, or nil if there is none
+func findOne(q Querier, query string, args ...interface{}) (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := q.QueryRow(query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up duplicate: %w", err)
+	}
+	return &id, nil
+}
+
+func matchOf(id *uuid.UUID, reason string) *Match {
+	if id == nil {
+		return nil
+	}
+	return &Match{OriginalID: *id, Reason: reason}
+}
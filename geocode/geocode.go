@@ -0,0 +1,187 @@
+// Package geocode turns coordinates into addresses without sending them
+// anywhere. It answers from a gazetteer file loaded into memory at startup, in
+// the tab-separated format of the GeoNames dumps (https://download.geonames.org/export/dump/),
+// such as cities15000.txt or a country file like IN.txt for points of interest.
+package geocode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sooraj1002/expense-tracker/place"
+)
+
+// Default is the index the server answers from. It is nil, and every lookup
+// returns no address, when no gazetteer is configured.
+var Default *Index
+
+// Search radii in metres. A point of interest names the exact spot only when
+// the fix is close to it; a town is good enough much further out.
+const (
+	poiRadius  = 250
+	townRadius = 25000
+)
+
+// GeoNames feature classes
+const (
+	classPopulated = 'P' // city, town, village
+	classSpot      = 'S' // building, mall, station
+	classArea      = 'L' // park, business area
+)
+
+// Entry is a named point from the gazetteer
+type Entry struct {
+	Name    string
+	Country string
+	Class   byte
+	Point   place.Point
+}
+
+// cellSize is the side of a grid cell in degrees, about 11 km of latitude
+const cellSize = 0.1
+
+type cell struct {
+	lat, lng int
+}
+
+func cellOf(p place.Point) cell {
+	return cell{int(math.Floor(p.Latitude / cellSize)), int(math.Floor(p.Longitude / cellSize))}
+}
+
+// Index is a gazetteer bucketed into a grid of cells, so a lookup only looks
+// at entries in the cells around the point. It is safe for concurrent use
+// once loaded.
+type Index struct {
+	entries []Entry
+	cells   map[cell][]int32
+}
+
+// Len returns the number of entries in the index
+func (idx *Index) Len() int {
+	if idx == nil {
+		return 0
+	}
+	return len(idx.entries)
+}
+
+// LoadFile reads a gazetteer file into an index
+func LoadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Load reads a gazetteer in GeoNames format: one entry per line with
+// tab-separated columns, of which the name (2nd), latitude (5th), longitude
+// (6th), feature class (7th) and country code (9th) are used. Only populated
+// places, spots and areas are kept.
+func Load(r io.Reader) (*Index, error) {
+	idx := &Index{cells: map[cell][]int32{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("line %d: expected at least 9 tab-separated fields, got %d", line, len(fields))
+		}
+		if len(fields[6]) != 1 || (fields[6][0] != classPopulated && fields[6][0] != classSpot && fields[6][0] != classArea) {
+			continue
+		}
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude %q", line, fields[4])
+		}
+		lng, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude %q", line, fields[5])
+		}
+
+		e := Entry{Name: fields[1], Country: fields[8], Class: fields[6][0], Point: place.Point{Latitude: lat, Longitude: lng}}
+		c := cellOf(e.Point)
+		idx.cells[c] = append(idx.cells[c], int32(len(idx.entries)))
+		idx.entries = append(idx.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// nearest returns the entry of one of the classes nearest to p within
+// maxDistance metres, or nil
+func (idx *Index) nearest(p place.Point, maxDistance float64, classes ...byte) *Entry {
+	dLat := int(math.Ceil(maxDistance / place.MetresPerDegree / cellSize))
+	dLng := int(math.Ceil(180 / cellSize))
+	if cos := math.Cos(p.Latitude * math.Pi / 180); cos > 0.01 {
+		dLng = int(math.Ceil(maxDistance / (place.MetresPerDegree * cos) / cellSize))
+	}
+
+	center := cellOf(p)
+	var best *Entry
+	bestDistance := maxDistance
+	for lat := center.lat - dLat; lat <= center.lat+dLat; lat++ {
+		for lng := center.lng - dLng; lng <= center.lng+dLng; lng++ {
+			for _, i := range idx.cells[cell{lat, lng}] {
+				e := &idx.entries[i]
+				if !hasClass(e.Class, classes) {
+					continue
+				}
+				if d := place.Distance(p, e.Point); d <= bestDistance {
+					best, bestDistance = e, d
+				}
+			}
+		}
+	}
+	return best
+}
+
+func hasClass(class byte, classes []byte) bool {
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Address describes where a point is, such as "Phoenix Marketcity, Bengaluru,
+// IN": the point of interest the point is at, if any, then the nearest town
+// and its country. It returns "" when nothing in the gazetteer is near enough
+// or no gazetteer is loaded.
+func (idx *Index) Address(latitude, longitude float64) string {
+	if idx == nil {
+		return ""
+	}
+	p := place.Point{Latitude: latitude, Longitude: longitude}
+
+	parts := []string{}
+	country := ""
+	if poi := idx.nearest(p, poiRadius, classSpot, classArea); poi != nil {
+		parts = append(parts, poi.Name)
+		country = poi.Country
+	}
+	if town := idx.nearest(p, townRadius, classPopulated); town != nil {
+		if len(parts) == 0 || parts[0] != town.Name {
+			parts = append(parts, town.Name)
+		}
+		country = town.Country
+	}
+	if country != "" {
+		parts = append(parts, country)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,87 @@
+// Package location links expenses and transactions to the location fix the
+// user's phone recorded nearest in time to them.
+package location
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Limits decide which fixes may be linked
+type Limits struct {
+	// Window is how far in time a fix may be from the expense or transaction
+	Window time.Duration
+	// MaxAccuracy is the largest accuracy radius in metres a fix may have; 0
+	// accepts any. Fixes without an accuracy are always accepted.
+	MaxAccuracy float64
+}
+
+// nearestFix selects the id of the user's fix nearest in time to the at
+// expression within the limits. It expects the user as $1, the window in
+// seconds as $2 and the maximum accuracy as $3.
+func nearestFix(at string) string {
+	return `SELECT l.id FROM locations l
+		WHERE l.user_id = $1
+			AND l.timestamp BETWEEN ` + at + ` - make_interval(secs => $2::float8) AND ` + at + ` + make_interval(secs => $2::float8)
+			AND ($3::float8 = 0 OR l.accuracy IS NULL OR l.accuracy <= $3::float8)
+		ORDER BY ABS(EXTRACT(EPOCH FROM l.timestamp - ` + at + `)) ASC, l.id ASC
+		LIMIT 1`
+}
+
+// Nearest returns the user's fix nearest in time to at, or nil if none is within the limits
+func Nearest(q Querier, userID uuid.UUID, at time.Time, limits Limits) (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := q.QueryRow(nearestFix("$4::timestamp"), userID, limits.Window.Seconds(), limits.MaxAccuracy, at).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find location: %w", err)
+	}
+	return &id, nil
+}
+
+// LinkUnlinked links the user's expenses and transactions between from and to
+// that have no location yet to their nearest fix. It is run when fixes arrive
+// after the expenses they belong to, which is usual as phones upload locations
+// in batches. Rows that are linked have updated_at set to now. It returns
+// how many expenses and transactions were linked.
+func LinkUnlinked(q Querier, userID uuid.UUID, from, to time.Time, limits Limits) (int64, int64, error) {
+	result, err := q.Exec(`
+		UPDATE expenses e SET location_id = n.location_id, updated_at = $6
+		FROM (
+			SELECT x.id, (`+nearestFix("x.date")+`) AS location_id
+			FROM expenses x
+			WHERE x.user_id = $1 AND x.location_id IS NULL AND x.date BETWEEN $4 AND $5
+		) n
+		WHERE e.id = n.id AND n.location_id IS NOT NULL
+	`, userID, limits.Window.Seconds(), limits.MaxAccuracy, from, to, time.Now())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to link expenses: %w", err)
+	}
+	expenses, _ := result.RowsAffected()
+
+	result, err = q.Exec(`
+		UPDATE transactions t SET location_id = n.location_id, updated_at = $6
+		FROM (
+			SELECT x.id, (`+nearestFix("x.timestamp")+`) AS location_id
+			FROM transactions x
+			WHERE x.user_id = $1 AND x.location_id IS NULL AND x.timestamp BETWEEN $4 AND $5
+		) n
+		WHERE t.id = n.id AND n.location_id IS NOT NULL
+	`, userID, limits.Window.Seconds(), limits.MaxAccuracy, from, to, time.Now())
+	if err != nil {
+		return expenses, 0, fmt.Errorf("failed to link transactions: %w", err)
+	}
+	transactions, _ := result.RowsAffected()
+	return expenses, transactions, nil
+}
@@ -0,0 +1,53 @@
+package matcher
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// cache holds each user's compiled patterns until they change. Every user's
+// entry carries a generation that Invalidate bumps, so a load that raced with
+// an invalidation is not stored.
+var cache = struct {
+	sync.Mutex
+	compiled    map[uuid.UUID]*Compiled
+	generations map[uuid.UUID]uint64
+}{
+	compiled:    map[uuid.UUID]*Compiled{},
+	generations: map[uuid.UUID]uint64{},
+}
+
+// ForUser returns the user's active patterns compiled for matching, loading
+// them through q on first use and after Invalidate
+func ForUser(q Querier, userID uuid.UUID) (*Compiled, error) {
+	cache.Lock()
+	c, ok := cache.compiled[userID]
+	generation := cache.generations[userID]
+	cache.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	patterns, err := LoadActivePatterns(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	c = Compile(patterns)
+
+	cache.Lock()
+	if cache.generations[userID] == generation {
+		cache.compiled[userID] = c
+	}
+	cache.Unlock()
+	return c, nil
+}
+
+// Invalidate drops the user's compiled patterns. Call it after any change to
+// the user's patterns has been committed.
+func Invalidate(userID uuid.UUID) {
+	cache.Lock()
+	delete(cache.compiled, userID)
+	cache.generations[userID]++
+	cache.Unlock()
+}
@@ -0,0 +1,248 @@
+package matcher
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Compiled is a user's active patterns prepared for matching many names. Exact
+// patterns are looked up in a map and contains, starts_with and ends_with
+// patterns are found in a single pass over the name with an Aho-Corasick
+// automaton; only word, regex and fuzzy patterns are tried one by one, with the
+// expressions of word and regex patterns compiled once here. It picks the same
+// pattern as Match and is safe for concurrent use.
+type Compiled struct {
+	patterns []models.MerchantPattern
+	exact    map[string][]int
+	literals *automaton
+	others   []int
+	// regexps holds the expression of each word and regex pattern, by index
+	regexps map[int]*regexp.Regexp
+}
+
+// Compile prepares patterns for matching. The order of patterns is the order
+// final ties are broken in, as with Match.
+func Compile(patterns []models.MerchantPattern) *Compiled {
+	c := &Compiled{
+		patterns: patterns,
+		exact:    map[string][]int{},
+		regexps:  map[int]*regexp.Regexp{},
+	}
+
+	literals := map[string][]int{}
+	for i, p := range patterns {
+		text := strings.ToLower(p.MerchantName)
+		switch {
+		case p.MatchType == models.MatchTypeExact:
+			c.exact[text] = append(c.exact[text], i)
+		case text != "" && (p.MatchType == models.MatchTypeContains || p.MatchType == models.MatchTypeStartsWith || p.MatchType == models.MatchTypeEndsWith):
+			literals[text] = append(literals[text], i)
+		case p.MatchType == models.MatchTypeWord || p.MatchType == models.MatchTypeRegex:
+			// A pattern whose expression does not compile never matches
+			if re, err := compile(p.MatchType, p.MerchantName); err == nil {
+				c.regexps[i] = re
+				c.others = append(c.others, i)
+			}
+		default:
+			c.others = append(c.others, i)
+		}
+	}
+	c.literals = newAutomaton(literals)
+	return c
+}
+
+// Len returns the number of patterns compiled
+func (c *Compiled) Len() int {
+	return len(c.patterns)
+}
+
+// Match returns a copy of the pattern that applies to the merchant name, or nil
+func (c *Compiled) Match(merchantName string) *models.MerchantPattern {
+	p, _ := c.MatchScore(merchantName)
+	return p
+}
+
+// MatchScore is Match that also returns how similar the name is to the
+// pattern, which is 1 unless it is a fuzzy pattern
+func (c *Compiled) MatchScore(merchantName string) (*models.MerchantPattern, float64) {
+	if merchantName == "" {
+		return nil, 0
+	}
+
+	best, bestHit := -1, hit{}
+	c.candidates(merchantName, func(i int, h hit) {
+		if best == -1 {
+			best, bestHit = i, h
+			return
+		}
+		// Candidates arrive out of order, so an equal one wins only if it comes first
+		cmp := compare(c.patterns[i], h, c.patterns[best], bestHit)
+		if cmp > 0 || (cmp == 0 && i < best) {
+			best, bestHit = i, h
+		}
+	})
+
+	if best == -1 {
+		return nil, 0
+	}
+	p := c.patterns[best]
+	return &p, bestHit.score
+}
+
+// MatchAll returns every pattern that matches the merchant name with its
+// score, in order of precedence, so the first is the one Match returns
+func (c *Compiled) MatchAll(merchantName string) []models.PatternCandidate {
+	found := c.matchAll(merchantName)
+	candidates := make([]models.PatternCandidate, len(found))
+	for i, f := range found {
+		candidates[i] = models.PatternCandidate{Pattern: c.patterns[f.index], Score: f.hit.score}
+	}
+	return candidates
+}
+
+// candidate is a pattern that matched a name, by its index in the compiled patterns
+type candidate struct {
+	index int
+	hit   hit
+}
+
+// matchAll returns the patterns that match the name in order of precedence,
+// with final ties going to the pattern that comes first
+func (c *Compiled) matchAll(merchantName string) []candidate {
+	found := []candidate{}
+	if merchantName == "" {
+		return found
+	}
+	seen := map[int]bool{}
+	c.candidates(merchantName, func(i int, h hit) {
+		// A contains pattern is found once for every occurrence
+		if !seen[i] {
+			seen[i] = true
+			found = append(found, candidate{i, h})
+		}
+	})
+	sort.Slice(found, func(x, y int) bool {
+		if cmp := compare(c.patterns[found[x].index], found[x].hit, c.patterns[found[y].index], found[y].hit); cmp != 0 {
+			return cmp > 0
+		}
+		return found[x].index < found[y].index
+	})
+	return found
+}
+
+// candidates calls fn with each pattern that matches the name and how, in no
+// particular order
+func (c *Compiled) candidates(merchantName string, fn func(i int, h hit)) {
+	name := strings.ToLower(merchantName)
+
+	for _, i := range c.exact[name] {
+		fn(i, hit{length: len(name), score: 1})
+	}
+
+	c.literals.find(name, func(text string, start, end int) {
+		for _, i := range c.literals.patterns[text] {
+			switch c.patterns[i].MatchType {
+			case models.MatchTypeContains:
+			case models.MatchTypeStartsWith:
+				if start != 0 {
+					continue
+				}
+			case models.MatchTypeEndsWith:
+				if end != len(name) {
+					continue
+				}
+			}
+			fn(i, hit{length: len(text), score: 1})
+		}
+	})
+
+	for _, i := range c.others {
+		if ok, h := matchCompiled(c.patterns[i], c.regexps[i], merchantName); ok {
+			fn(i, h)
+		}
+	}
+}
+
+// automaton is an Aho-Corasick automaton over the bytes of a set of strings
+type automaton struct {
+	nodes    []node
+	patterns map[string][]int
+}
+
+type node struct {
+	next map[byte]int
+	fail int
+	// out holds the strings that end at this node, including those reached
+	// through fail links
+	out []string
+}
+
+func newAutomaton(patterns map[string][]int) *automaton {
+	a := &automaton{
+		nodes:    []node{{next: map[byte]int{}}},
+		patterns: patterns,
+	}
+
+	for text := range patterns {
+		state := 0
+		for i := 0; i < len(text); i++ {
+			next, ok := a.nodes[state].next[text[i]]
+			if !ok {
+				next = len(a.nodes)
+				a.nodes = append(a.nodes, node{next: map[byte]int{}})
+				a.nodes[state].next[text[i]] = next
+			}
+			state = next
+		}
+		a.nodes[state].out = append(a.nodes[state].out, text)
+	}
+
+	// Breadth first, so a node's fail target is complete before the node is
+	queue := []int{}
+	for _, child := range a.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range a.nodes[state].next {
+			fail := a.nodes[state].fail
+			for {
+				if target, ok := a.nodes[fail].next[b]; ok && target != child {
+					a.nodes[child].fail = target
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = a.nodes[fail].fail
+			}
+			a.nodes[child].out = append(a.nodes[child].out, a.nodes[a.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+// find calls fn with every occurrence of one of the strings in text
+func (a *automaton) find(text string, fn func(found string, start, end int)) {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := a.nodes[state].next[text[i]]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = a.nodes[state].fail
+		}
+		for _, found := range a.nodes[state].out {
+			fn(found, i+1-len(found), i+1)
+		}
+	}
+}
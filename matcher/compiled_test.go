@@ -0,0 +1,171 @@
+package matcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+func pattern(name, matchType string, priority int) models.MerchantPattern {
+	return models.MerchantPattern{
+		ID:           uuid.New(),
+		MerchantName: name,
+		CategoryID:   uuid.New(),
+		MatchType:    matchType,
+		Priority:     priority,
+		IsActive:     true,
+		CreatedAt:    time.Now(),
+	}
+}
+
+func TestCompiledMatchesMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []models.MerchantPattern
+		names    []string
+		// want holds, for each name, the index of the pattern that should win, or -1 for none
+		want []int
+	}{
+		{
+			name: "overlapping contains literals",
+			patterns: []models.MerchantPattern{
+				pattern("uber", models.MatchTypeContains, 0),
+				pattern("uber eats", models.MatchTypeContains, 0),
+			},
+			names: []string{"UBER EATS INDIA", "Uber Trip", "uber eats", "ubereats", "Eats"},
+			want:  []int{1, 0, 1, 0, -1},
+		},
+		{
+			// eats is only found inside "uber eats" through a fail link
+			name: "literal inside another",
+			patterns: []models.MerchantPattern{
+				pattern("eats", models.MatchTypeContains, 1),
+				pattern("uber eats", models.MatchTypeContains, 0),
+				pattern("ber", models.MatchTypeEndsWith, 2),
+			},
+			names: []string{"uber eats", "swiggy eats", "uber eat", "uber"},
+			want:  []int{0, 0, -1, 2},
+		},
+		{
+			name: "starts_with and ends_with boundaries",
+			patterns: []models.MerchantPattern{
+				pattern("amazon", models.MatchTypeStartsWith, 0),
+				pattern("pay", models.MatchTypeEndsWith, 0),
+			},
+			names: []string{"Amazon Pay", "amazon", "Pay at Amazon", "my amazon", "paytm", "gpay", "pay"},
+			want:  []int{0, 0, -1, -1, -1, 1, 1},
+		},
+		{
+			name: "starts_with and ends_with of the same text",
+			patterns: []models.MerchantPattern{
+				pattern("abab", models.MatchTypeEndsWith, 0),
+				pattern("ab", models.MatchTypeStartsWith, 0),
+			},
+			names: []string{"ababab", "abab", "xabab", "abx"},
+			want:  []int{0, 0, 0, 1},
+		},
+		{
+			name: "exact beats a longer literal",
+			patterns: []models.MerchantPattern{
+				pattern("amazon pay", models.MatchTypeContains, 0),
+				pattern("amazon pay", models.MatchTypeExact, 0),
+			},
+			names: []string{"Amazon Pay", "Amazon Pay India"},
+			want:  []int{1, 0},
+		},
+		{
+			name: "exact ties go to the first pattern",
+			patterns: []models.MerchantPattern{
+				pattern("Swiggy", models.MatchTypeExact, 0),
+				pattern("swiggy", models.MatchTypeExact, 0),
+			},
+			names: []string{"SWIGGY", "swiggy instamart"},
+			want:  []int{0, -1},
+		},
+		{
+			name: "literal ties go to the first pattern",
+			patterns: []models.MerchantPattern{
+				pattern("zomato", models.MatchTypeEndsWith, 0),
+				pattern("zomato", models.MatchTypeContains, 0),
+				pattern("zomato", models.MatchTypeStartsWith, 0),
+			},
+			names: []string{"zomato", "zomato ltd", "paid zomato ltd"},
+			want:  []int{0, 1, 1},
+		},
+		{
+			name: "priority beats specificity",
+			patterns: []models.MerchantPattern{
+				pattern("uber eats", models.MatchTypeExact, 0),
+				pattern("uber", models.MatchTypeContains, 5),
+			},
+			names: []string{"uber eats", "uber"},
+			want:  []int{1, 1},
+		},
+		{
+			name: "priority ties fall back to specificity then order",
+			patterns: []models.MerchantPattern{
+				pattern("ub", models.MatchTypeContains, 3),
+				pattern("uber", models.MatchTypeContains, 3),
+				pattern("uber", models.MatchTypeStartsWith, 3),
+				pattern("uber eats", models.MatchTypeContains, 1),
+			},
+			names: []string{"uber eats", "club", "my uber"},
+			want:  []int{1, 0, 1},
+		},
+		{
+			name: "literals alongside word, regex and fuzzy patterns",
+			patterns: []models.MerchantPattern{
+				pattern("bp", models.MatchTypeWord, 0),
+				pattern("^shell", models.MatchTypeRegex, 0),
+				pattern("starbucks coffee", models.MatchTypeFuzzy, 0),
+				pattern("shell petrol", models.MatchTypeContains, 0),
+			},
+			names: []string{"BP Fuel", "bpcl", "Shell Petrol Pump", "Shell", "Starbucks Cofee", ""},
+			want:  []int{0, -1, 3, 1, 2, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled := Compile(tt.patterns)
+			for i, name := range tt.names {
+				want, wantScore := (*models.MerchantPattern)(nil), 0.0
+				if tt.want[i] >= 0 {
+					want = &tt.patterns[tt.want[i]]
+					_, h := match(*want, name)
+					wantScore = h.score
+				}
+
+				if got := Match(name, tt.patterns); !samePattern(got, want) {
+					t.Errorf("Match(%q) = %s, want %s", name, describe(got), describe(want))
+				}
+				got, score := compiled.MatchScore(name)
+				if !samePattern(got, want) {
+					t.Errorf("Compiled.MatchScore(%q) = %s, want %s", name, describe(got), describe(want))
+				}
+				if score != wantScore {
+					t.Errorf("Compiled.MatchScore(%q) score = %v, want %v", name, score, wantScore)
+				}
+				if all := compiled.MatchAll(name); want != nil && (len(all) == 0 || all[0].Pattern.ID != want.ID) {
+					t.Errorf("Compiled.MatchAll(%q) does not start with %s", name, describe(want))
+				}
+			}
+		})
+	}
+}
+
+func samePattern(a, b *models.MerchantPattern) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID
+}
+
+func describe(p *models.MerchantPattern) string {
+	if p == nil {
+		return "no pattern"
+	}
+	return p.MatchType + " " + p.MerchantName
+}
@@ -0,0 +1,98 @@
+package matcher
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// DefaultFuzzyThreshold is the similarity a fuzzy pattern needs when it does
+// not set its own threshold
+const DefaultFuzzyThreshold = 0.5
+
+// Similarity is the trigram similarity of two strings, from 0 to 1. It follows
+// Postgres pg_trgm's similarity(): case is ignored, the strings are split into
+// words of letters and digits, and each word is padded with two spaces in front
+// and one behind before taking its three-character sequences. The score is the
+// number of trigrams shared divided by the number in either string.
+//
+// Matching runs in process on the cached patterns, so this is computed here
+// rather than in the database; scores are the same as pg_trgm would give.
+func Similarity(a, b string) float64 {
+	return similarity(trigrams(words(a)), trigrams(words(b)))
+}
+
+// fuzzyScore scores a pattern against a merchant name. Bank messages often add
+// words around the merchant ("STARBUCKS COFF BLR 0042"), so besides the whole
+// name every run of consecutive words up to one longer than the pattern is
+// compared, and the best score is kept. It returns the score and the length
+// of the best matching text.
+func fuzzyScore(pattern, merchantName string) (float64, int) {
+	patternWords := words(pattern)
+	if len(patternWords) == 0 {
+		return 0, 0
+	}
+	patternTrigrams := trigrams(patternWords)
+
+	nameWords := words(merchantName)
+	best, bestLength := similarity(patternTrigrams, trigrams(nameWords)), len(strings.Join(nameWords, " "))
+	for size := 1; size <= len(patternWords)+1 && size < len(nameWords); size++ {
+		for start := 0; start+size <= len(nameWords); start++ {
+			window := nameWords[start : start+size]
+			if score := similarity(patternTrigrams, trigrams(window)); score > best {
+				best, bestLength = score, len(strings.Join(window, " "))
+			}
+		}
+	}
+	return best, bestLength
+}
+
+// words lower-cases s and splits it into runs of letters and digits
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the set of padded trigrams of the words
+func trigrams(words []string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range words {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// ValidateThreshold checks that a fuzzy threshold is above 0 and at most 1, and
+// is only given to a fuzzy pattern. Request binding checks the range too, but
+// patterns from syncs and imported packs are not bound.
+func ValidateThreshold(matchType string, threshold *float64) error {
+	if threshold == nil {
+		return nil
+	}
+	if *threshold <= 0 || *threshold > 1 {
+		return errors.New("fuzzyThreshold must be above 0 and at most 1")
+	}
+	if matchType != models.MatchTypeFuzzy {
+		return errors.New("fuzzyThreshold only applies to fuzzy patterns")
+	}
+	return nil
+}
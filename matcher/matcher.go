@@ -0,0 +1,278 @@
+// Package matcher decides which of a user's merchant patterns applies to a
+// merchant name.
+package matcher
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// LoadActivePatterns returns the user's active merchant patterns, highest priority
+// first and otherwise oldest first, which is the order Match breaks final ties in
+func LoadActivePatterns(q Querier, userID uuid.UUID) ([]models.MerchantPattern, error) {
+	rows, err := q.Query(`
+		SELECT id, user_id, merchant_name, category_id, match_type, priority, fuzzy_threshold, is_active, use_count, last_used_at, created_at, updated_at
+		FROM merchant_patterns
+		WHERE user_id = $1 AND is_active = true
+		ORDER BY priority DESC, created_at ASC, id ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	patterns := []models.MerchantPattern{}
+	for rows.Next() {
+		var p models.MerchantPattern
+		err := rows.Scan(&p.ID, &p.UserID, &p.MerchantName, &p.CategoryID, &p.MatchType, &p.Priority, &p.FuzzyThreshold, &p.IsActive, &p.UseCount, &p.LastUsedAt, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+
+	return patterns, rows.Err()
+}
+
+// Matches reports whether a single pattern matches the merchant name (case-insensitive).
+// A regex pattern that does not compile never matches.
+func Matches(p models.MerchantPattern, merchantName string) bool {
+	ok, _ := match(p, merchantName)
+	return ok
+}
+
+// Match returns the pattern that applies to the merchant name, or nil. Among the
+// patterns that match, the highest priority wins; ties go to an exact pattern,
+// then to the pattern matching the longest part of the name, then to the
+// pattern that comes first in the given order.
+func Match(merchantName string, patterns []models.MerchantPattern) *models.MerchantPattern {
+	if merchantName == "" {
+		return nil
+	}
+
+	var best *models.MerchantPattern
+	var bestHit hit
+	for i := range patterns {
+		ok, h := match(patterns[i], merchantName)
+		if !ok {
+			continue
+		}
+		if best == nil || compare(patterns[i], h, *best, bestHit) > 0 {
+			best = &patterns[i]
+			bestHit = h
+		}
+	}
+	return best
+}
+
+// Conflicts lists pairs of patterns that both match one of the sample names but
+// assign different categories. Each pair is reported once, with the first sample
+// that shows the overlap and the pattern Match would pick for it. The literal
+// text of non-regex patterns is always used as a sample as well. Matching
+// ignores case, so samples differing only in case are tried once.
+func Conflicts(patterns []models.MerchantPattern, samples []string) []models.PatternConflict {
+	names := []string{}
+	seen := map[string]bool{}
+	addName := func(name string) {
+		key := strings.ToLower(name)
+		if name != "" && !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range samples {
+		addName(name)
+	}
+	for _, p := range patterns {
+		if p.MatchType != models.MatchTypeRegex {
+			addName(p.MerchantName)
+		}
+	}
+
+	type pair struct{ a, b int }
+	set := Compile(patterns)
+	found := map[pair]models.PatternConflict{}
+	for _, name := range names {
+		// Candidates are in precedence order, so the first of two always wins
+		matched := set.matchAll(name)
+		for x := 0; x < len(matched); x++ {
+			for y := x + 1; y < len(matched); y++ {
+				winner, loser := matched[x], matched[y]
+				if patterns[winner.index].CategoryID == patterns[loser.index].CategoryID {
+					continue
+				}
+				key := pair{winner.index, loser.index}
+				if loser.index < winner.index {
+					key = pair{loser.index, winner.index}
+				}
+				if _, ok := found[key]; ok {
+					continue
+				}
+
+				a, b := patterns[key.a], patterns[key.b]
+				resolvedBy := models.ConflictResolvedByOrder
+				if a.Priority != b.Priority {
+					resolvedBy = models.ConflictResolvedByPriority
+				} else if compare(patterns[winner.index], winner.hit, patterns[loser.index], loser.hit) != 0 {
+					resolvedBy = models.ConflictResolvedBySpecificity
+				}
+				found[key] = models.PatternConflict{
+					Patterns:   []models.MerchantPattern{a, b},
+					Example:    name,
+					WinnerID:   patterns[winner.index].ID,
+					ResolvedBy: resolvedBy,
+				}
+			}
+		}
+	}
+
+	// Report pairs in pattern order
+	pairs := make([]pair, 0, len(found))
+	for key := range found {
+		pairs = append(pairs, key)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].a != pairs[j].a {
+			return pairs[i].a < pairs[j].a
+		}
+		return pairs[i].b < pairs[j].b
+	})
+	conflicts := make([]models.PatternConflict, 0, len(pairs))
+	for _, key := range pairs {
+		conflicts = append(conflicts, found[key])
+	}
+	return conflicts
+}
+
+// hit describes how a pattern matched a name: how many characters of the name
+// it covers and how similar they are, which is 1 except for fuzzy patterns
+type hit struct {
+	length int
+	score  float64
+}
+
+// compare orders two matching patterns by priority, then exactness, then
+// certainty, so that any other match beats a fuzzy one and a closer fuzzy match
+// beats a looser one, then the length of the matched text. It returns a
+// positive number if a should win.
+func compare(a models.MerchantPattern, hitA hit, b models.MerchantPattern, hitB hit) int {
+	if a.Priority != b.Priority {
+		return a.Priority - b.Priority
+	}
+	exactA, exactB := a.MatchType == models.MatchTypeExact, b.MatchType == models.MatchTypeExact
+	if exactA != exactB {
+		if exactA {
+			return 1
+		}
+		return -1
+	}
+	if hitA.score != hitB.score {
+		if hitA.score > hitB.score {
+			return 1
+		}
+		return -1
+	}
+	return hitA.length - hitB.length
+}
+
+// match reports whether the pattern matches the name and how. The expression of
+// a word or regex pattern is compiled on every call; Compiled keeps it instead.
+func match(p models.MerchantPattern, merchantName string) (bool, hit) {
+	var re *regexp.Regexp
+	if p.MatchType == models.MatchTypeWord || p.MatchType == models.MatchTypeRegex {
+		var err error
+		if re, err = compile(p.MatchType, p.MerchantName); err != nil {
+			return false, hit{}
+		}
+	}
+	return matchCompiled(p, re, merchantName)
+}
+
+// matchCompiled is match with the expression of a word or regex pattern
+// already compiled
+func matchCompiled(p models.MerchantPattern, re *regexp.Regexp, merchantName string) (bool, hit) {
+	name := strings.ToLower(merchantName)
+	patternName := strings.ToLower(p.MerchantName)
+	literal := hit{length: len(patternName), score: 1}
+
+	switch p.MatchType {
+	case models.MatchTypeExact:
+		return name == patternName, literal
+	case models.MatchTypeContains:
+		return strings.Contains(name, patternName), literal
+	case models.MatchTypeStartsWith:
+		return strings.HasPrefix(name, patternName), literal
+	case models.MatchTypeEndsWith:
+		return strings.HasSuffix(name, patternName), literal
+	case models.MatchTypeWord:
+		return re.MatchString(merchantName), hit{length: len(strings.TrimSpace(patternName)), score: 1}
+	case models.MatchTypeRegex:
+		loc := re.FindStringIndex(merchantName)
+		if loc == nil {
+			return false, hit{}
+		}
+		return true, hit{length: loc[1] - loc[0], score: 1}
+	case models.MatchTypeFuzzy:
+		threshold := DefaultFuzzyThreshold
+		if p.FuzzyThreshold != nil {
+			threshold = *p.FuzzyThreshold
+		}
+		score, length := fuzzyScore(p.MerchantName, merchantName)
+		return score >= threshold, hit{length: length, score: score}
+	}
+	return false, hit{}
+}
+
+// Validate checks that a pattern value can be used with the match type. Regex
+// patterns are compiled, so a bad expression is rejected when the pattern is
+// saved rather than silently never matching.
+func Validate(matchType, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("pattern must not be empty")
+	}
+	if matchType == models.MatchTypeFuzzy && len(words(value)) == 0 {
+		return errors.New("fuzzy pattern must contain letters or digits")
+	}
+	if matchType == models.MatchTypeWord || matchType == models.MatchTypeRegex {
+		if _, err := compile(matchType, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compile returns the case-insensitive expression for a word or regex pattern
+func compile(matchType, value string) (*regexp.Regexp, error) {
+	expr := value
+	if matchType == models.MatchTypeWord {
+		expr = `(^|[^\pL\pN])` + regexp.QuoteMeta(strings.TrimSpace(value)) + `($|[^\pL\pN])`
+	}
+
+	// Parse the expression as given first so errors point at the user's text
+	if _, err := syntax.Parse(expr, syntax.Perl); err != nil {
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("invalid regex: %s: `%s`", syntaxErr.Code, syntaxErr.Expr)
+		}
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,147 @@
+package matcher
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Sample is a merchant name and the category a user confirmed for it
+type Sample struct {
+	MerchantName string
+	CategoryID   uuid.UUID
+}
+
+// maxSuggestionExamples caps the raw names returned with each suggestion
+const maxSuggestionExamples = 5
+
+// Suggest proposes patterns from categorised samples. Samples are grouped by
+// normalised merchant name, and a group becomes a suggestion when it has at
+// least minSupport samples and at least minConfidence of them share a
+// category. The pattern is a contains pattern on the normalised name when
+// every raw name in the group contains it, or an exact pattern when the group
+// has a single raw name; other groups are skipped.
+//
+// Groups that the compiled patterns already send to the suggested category
+// are left out, as are names in taken (lower case), which holds the names of
+// the user's existing patterns. When a pattern with another category would
+// still win over the suggestion for some of the names, the suggestion gets a
+// priority above it.
+func Suggest(samples []Sample, compiled *Compiled, taken map[string]bool, minSupport int, minConfidence float64) []models.PatternSuggestion {
+	type group struct {
+		total      int
+		categories map[uuid.UUID]int
+		names      map[string]int
+	}
+	groups := map[string]*group{}
+	keys := []string{}
+	for _, s := range samples {
+		key := merchant.Normalize(s.MerchantName)
+		if key == "" {
+			continue
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{categories: map[uuid.UUID]int{}, names: map[string]int{}}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.total++
+		g.categories[s.CategoryID]++
+		g.names[s.MerchantName]++
+	}
+
+	suggestions := []models.PatternSuggestion{}
+	for _, key := range keys {
+		g := groups[key]
+		if g.total < minSupport {
+			continue
+		}
+
+		var categoryID uuid.UUID
+		top := 0
+		for id, count := range g.categories {
+			if count > top || (count == top && id.String() < categoryID.String()) {
+				categoryID, top = id, count
+			}
+		}
+		confidence := float64(top) / float64(g.total)
+		if confidence < minConfidence {
+			continue
+		}
+
+		// Most frequent raw names first
+		names := make([]string, 0, len(g.names))
+		for name := range g.names {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if g.names[names[i]] != g.names[names[j]] {
+				return g.names[names[i]] > g.names[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		suggestion := models.PatternSuggestion{
+			MerchantName: key,
+			MatchType:    models.MatchTypeContains,
+			CategoryID:   categoryID,
+			Confidence:   confidence,
+			Support:      g.total,
+		}
+		contains := models.MerchantPattern{MerchantName: key, MatchType: models.MatchTypeContains}
+		for _, name := range names {
+			if !Matches(contains, name) {
+				suggestion.MatchType = ""
+				break
+			}
+		}
+		if suggestion.MatchType == "" {
+			if len(names) > 1 {
+				continue
+			}
+			suggestion.MerchantName = names[0]
+			suggestion.MatchType = models.MatchTypeExact
+		}
+		if taken[strings.ToLower(suggestion.MerchantName)] {
+			continue
+		}
+
+		proposed := models.MerchantPattern{MerchantName: suggestion.MerchantName, MatchType: suggestion.MatchType}
+		covered := true
+		for _, name := range names {
+			current := compiled.Match(name)
+			if current != nil && current.CategoryID == categoryID {
+				continue
+			}
+			covered = false
+			if current == nil {
+				continue
+			}
+			// Existing patterns win ties, so outrank one that would still win
+			_, currentHit := match(*current, name)
+			_, proposedHit := match(proposed, name)
+			if compare(*current, currentHit, proposed, proposedHit) >= 0 {
+				proposed.Priority = current.Priority + 1
+			}
+		}
+		suggestion.Priority = proposed.Priority
+		if covered {
+			continue
+		}
+
+		if len(names) > maxSuggestionExamples {
+			names = names[:maxSuggestionExamples]
+		}
+		suggestion.Examples = names
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Support > suggestions[j].Support
+	})
+	return suggestions
+}
@@ -0,0 +1,90 @@
+package matcher
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// RecordMatch bumps the pattern's use count and last use time and logs the match
+// for the stats endpoint, in a single statement. expenseID is the expense the
+// pattern categorised, if any. The pattern is updated in place with the stored
+// counters.
+func RecordMatch(q Querier, p *models.MerchantPattern, expenseID *uuid.UUID, source string) error {
+	err := q.QueryRow(`
+		WITH used AS (
+			UPDATE merchant_patterns
+			SET use_count = use_count + 1, last_used_at = $1
+			WHERE id = $2
+			RETURNING id, user_id, category_id, use_count, last_used_at
+		), logged AS (
+			INSERT INTO pattern_matches (user_id, pattern_id, expense_id, category_id, source, matched_at)
+			SELECT user_id, id, $3, category_id, $4, $1 FROM used
+		)
+		SELECT use_count, last_used_at FROM used
+	`, time.Now(), p.ID, expenseID, source).Scan(&p.UseCount, &p.LastUsedAt)
+	if err == sql.ErrNoRows {
+		// The pattern was deleted since it was loaded
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record pattern match: %w", err)
+	}
+	return nil
+}
+
+// RecordMatches records one match for every entry of patterns, which may repeat,
+// in a single statement, and updates them in place with the stored counters
+func RecordMatches(q Querier, patterns []*models.MerchantPattern, source string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	ids := make([]string, len(patterns))
+	for i, p := range patterns {
+		ids[i] = p.ID.String()
+	}
+
+	rows, err := q.Query(`
+		WITH hits AS (
+			SELECT unnest($2::uuid[]) AS pattern_id
+		), used AS (
+			UPDATE merchant_patterns p
+			SET use_count = p.use_count + h.hits, last_used_at = $1
+			FROM (SELECT pattern_id, COUNT(*) AS hits FROM hits GROUP BY pattern_id) h
+			WHERE p.id = h.pattern_id
+			RETURNING p.id, p.user_id, p.category_id, p.use_count, p.last_used_at
+		), logged AS (
+			INSERT INTO pattern_matches (user_id, pattern_id, category_id, source, matched_at)
+			SELECT u.user_id, u.id, u.category_id, $3, $1 FROM hits h JOIN used u ON u.id = h.pattern_id
+		)
+		SELECT id, use_count, last_used_at FROM used
+	`, time.Now(), pq.Array(ids), source)
+	if err != nil {
+		return fmt.Errorf("failed to record pattern matches: %w", err)
+	}
+	defer rows.Close()
+
+	stored := map[uuid.UUID]models.MerchantPattern{}
+	for rows.Next() {
+		var p models.MerchantPattern
+		if err := rows.Scan(&p.ID, &p.UseCount, &p.LastUsedAt); err != nil {
+			return fmt.Errorf("failed to record pattern matches: %w", err)
+		}
+		stored[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to record pattern matches: %w", err)
+	}
+
+	for _, p := range patterns {
+		if s, ok := stored[p.ID]; ok {
+			p.UseCount = s.UseCount
+			p.LastUsedAt = s.LastUsedAt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+// Package merchant maintains the per-user merchant records that expenses are
+// linked to, along with their spending counters.
+package merchant
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Resolve returns the user's merchant whose name or one of whose aliases
+// normalises to the same key as the raw name, or nil if there is none.
+// Merchants the user created or curated win over auto-created ones.
+func Resolve(q Querier, userID uuid.UUID, raw string) (*uuid.UUID, error) {
+	key := Normalize(raw)
+	if key == "" {
+		return nil, nil
+	}
+
+	var id uuid.UUID
+	err := q.QueryRow(`
+		SELECT id FROM merchant_info
+		WHERE user_id = $1 AND match_keys @> ARRAY[$2]::TEXT[]
+		ORDER BY auto_created ASC, created_at ASC
+		LIMIT 1
+	`, userID, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve merchant: %w", err)
+	}
+	return &id, nil
+}
+
+// UpdateKeys recomputes the lookup keys Resolve uses from the stored name and
+// aliases of the given merchants. Call it after changing either.
+func UpdateKeys(q Querier, merchantIDs ...uuid.UUID) error {
+	for _, id := range merchantIDs {
+		var name string
+		var aliases pq.StringArray
+		err := q.QueryRow("SELECT name, aliases FROM merchant_info WHERE id = $1", id).Scan(&name, &aliases)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get merchant: %w", err)
+		}
+
+		if _, err := q.Exec("UPDATE merchant_info SET match_keys = $1 WHERE id = $2", keysOf(name, aliases), id); err != nil {
+			return fmt.Errorf("failed to update merchant keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// BackfillKeys fills in the lookup keys of merchants that have none, batch by
+// batch, and returns how many it filled in. Migrations leave the keys empty
+// because only the normaliser here can compute them.
+func BackfillKeys(q Querier) (int, error) {
+	const batchSize = 500
+
+	filled := 0
+	for {
+		rows, err := q.Query("SELECT id FROM merchant_info WHERE match_keys IS NULL LIMIT $1", batchSize)
+		if err != nil {
+			return filled, fmt.Errorf("failed to get merchants without keys: %w", err)
+		}
+		ids := []uuid.UUID{}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return filled, fmt.Errorf("failed to scan merchant: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			return filled, nil
+		}
+
+		if err := UpdateKeys(q, ids...); err != nil {
+			return filled, err
+		}
+		filled += len(ids)
+	}
+}
+
+// Upsert resolves the raw name to one of the user's merchants, creating an
+// auto merchant named after the normalised key when none matches. It returns
+// nil for an empty name. A newly created merchant row stays locked until the
+// surrounding transaction ends, so concurrent writers for it are serialised.
+func Upsert(q Querier, userID uuid.UUID, raw string) (*uuid.UUID, error) {
+	id, err := Resolve(q, userID, raw)
+	if err != nil || id != nil {
+		return id, err
+	}
+
+	key := Normalize(raw)
+	if key == "" {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var created uuid.UUID
+	err = q.QueryRow(`
+		INSERT INTO merchant_info (user_id, name, aliases, match_keys, auto_created, created_at, updated_at)
+		VALUES ($1, $2, '{}', $3, true, $4, $4)
+		ON CONFLICT (user_id, name) DO UPDATE SET updated_at = EXCLUDED.updated_at
+		RETURNING id
+	`, userID, key, keysOf(key, nil), now).Scan(&created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert merchant: %w", err)
+	}
+	return &created, nil
+}
+
+// Relink moves every expense and transaction of the user whose raw merchant
+// name now resolves to the given merchant onto it. Names are only taken from
+// auto-created merchants, never from ones the user curated. Auto merchants
+// left without expenses are deleted, and the counters of every merchant
+// involved are refreshed.
+func Relink(q Querier, userID, merchantID uuid.UUID) error {
+	var name string
+	var aliases pq.StringArray
+	err := q.QueryRow("SELECT name, aliases FROM merchant_info WHERE id = $1 AND user_id = $2 FOR UPDATE", merchantID, userID).Scan(&name, &aliases)
+	if err != nil {
+		return fmt.Errorf("failed to get merchant: %w", err)
+	}
+	keys := map[string]bool{Normalize(name): true}
+	for _, alias := range aliases {
+		keys[Normalize(alias)] = true
+	}
+
+	// Only names linked to no merchant or to another auto-created one are moved
+	const movable = "(merchant_id IS NULL OR merchant_id IN (SELECT id FROM merchant_info WHERE user_id = $1 AND auto_created AND id <> $2))"
+
+	expenseNames, err := matchingNames(q, keys, "SELECT DISTINCT merchant_name FROM expenses WHERE user_id = $1 AND merchant_name IS NOT NULL AND "+movable, userID, merchantID)
+	if err != nil {
+		return err
+	}
+	transactionNames, err := matchingNames(q, keys, "SELECT DISTINCT merchant_name FROM transactions WHERE user_id = $1 AND merchant_name IS NOT NULL AND "+movable, userID, merchantID)
+	if err != nil {
+		return err
+	}
+
+	previous := []*uuid.UUID{}
+	if len(expenseNames) > 0 {
+		rows, err := q.Query("SELECT DISTINCT merchant_id FROM expenses WHERE user_id = $1 AND merchant_name = ANY($3) AND "+movable,
+			userID, merchantID, pq.Array(expenseNames))
+		if err != nil {
+			return fmt.Errorf("failed to get previous merchants: %w", err)
+		}
+		for rows.Next() {
+			var id *uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan previous merchant: %w", err)
+			}
+			previous = append(previous, id)
+		}
+		rows.Close()
+
+		_, err = q.Exec("UPDATE expenses SET merchant_id = $2, updated_at = $4 WHERE user_id = $1 AND merchant_name = ANY($3) AND "+movable,
+			userID, merchantID, pq.Array(expenseNames), time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to relink expenses: %w", err)
+		}
+	}
+	if len(transactionNames) > 0 {
+		_, err = q.Exec("UPDATE transactions SET merchant_id = $2, updated_at = $4 WHERE user_id = $1 AND merchant_name = ANY($3) AND "+movable,
+			userID, merchantID, pq.Array(transactionNames), time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to relink transactions: %w", err)
+		}
+	}
+
+	if err := Refresh(q, append(previous, &merchantID)...); err != nil {
+		return err
+	}
+
+	ids := []uuid.UUID{}
+	for _, id := range previous {
+		if id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	_, err = q.Exec(`
+		DELETE FROM merchant_info m
+		WHERE m.id = ANY($1::uuid[]) AND m.auto_created
+			AND NOT EXISTS (SELECT 1 FROM expenses WHERE merchant_id = m.id)
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to delete emptied merchants: %w", err)
+	}
+	return nil
+}
+
+// Merge folds the source merchant into the target. The source's name and
+// aliases become aliases of the target, its expenses and transactions are moved
+// over, merchant patterns naming it are renamed to the target, and the source
+// is deleted. It returns how many expenses were moved and patterns rewritten.
+func Merge(q Querier, userID, sourceID, targetID uuid.UUID) (int, int, error) {
+	// Lock both rows in a fixed order so concurrent merges cannot deadlock
+	rows, err := q.Query(`
+		SELECT id, name, aliases FROM merchant_info
+		WHERE user_id = $1 AND id IN ($2, $3)
+		ORDER BY id
+		FOR UPDATE
+	`, userID, sourceID, targetID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lock merchants: %w", err)
+	}
+	names := map[uuid.UUID]string{}
+	aliases := map[uuid.UUID]pq.StringArray{}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		var a pq.StringArray
+		if err := rows.Scan(&id, &name, &a); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan merchant: %w", err)
+		}
+		names[id] = name
+		aliases[id] = a
+	}
+	rows.Close()
+	if len(names) != 2 {
+		return 0, 0, fmt.Errorf("failed to lock merchants: expected 2, found %d", len(names))
+	}
+
+	sourceName, targetName := names[sourceID], names[targetID]
+	combined := pq.StringArray{}
+	seen := map[string]bool{targetName: true}
+	for _, alias := range append(append(append([]string{}, aliases[targetID]...), sourceName), aliases[sourceID]...) {
+		if !seen[alias] {
+			seen[alias] = true
+			combined = append(combined, alias)
+		}
+	}
+
+	now := time.Now()
+	_, err = q.Exec("UPDATE merchant_info SET aliases = $1, auto_created = false, updated_at = $2 WHERE id = $3", combined, now, targetID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to update merchant aliases: %w", err)
+	}
+	if err := UpdateKeys(q, targetID); err != nil {
+		return 0, 0, err
+	}
+
+	result, err := q.Exec("UPDATE expenses SET merchant_id = $1, updated_at = $2 WHERE merchant_id = $3", targetID, now, sourceID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to move expenses: %w", err)
+	}
+	expensesMoved, _ := result.RowsAffected()
+
+	if _, err := q.Exec("UPDATE transactions SET merchant_id = $1, updated_at = $2 WHERE merchant_id = $3", targetID, now, sourceID); err != nil {
+		return 0, 0, fmt.Errorf("failed to move transactions: %w", err)
+	}
+
+	// A pattern the target already has wins over the source's one
+	patternsRewritten := int64(0)
+	if !strings.EqualFold(sourceName, targetName) {
+		result, err = q.Exec(`
+			DELETE FROM merchant_patterns
+			WHERE user_id = $1 AND LOWER(merchant_name) = LOWER($2)
+				AND EXISTS (SELECT 1 FROM merchant_patterns WHERE user_id = $1 AND LOWER(merchant_name) = LOWER($3))
+		`, userID, sourceName, targetName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to delete merchant patterns: %w", err)
+		}
+		deleted, _ := result.RowsAffected()
+
+		result, err = q.Exec(`
+			UPDATE merchant_patterns SET merchant_name = $1, updated_at = $2
+			WHERE user_id = $3 AND LOWER(merchant_name) = LOWER($4)
+		`, targetName, now, userID, sourceName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to rewrite merchant patterns: %w", err)
+		}
+		renamed, _ := result.RowsAffected()
+		patternsRewritten = deleted + renamed
+	}
+
+	if _, err := q.Exec("DELETE FROM merchant_info WHERE id = $1", sourceID); err != nil {
+		return 0, 0, fmt.Errorf("failed to delete merchant: %w", err)
+	}
+
+	if err := Refresh(q, &targetID); err != nil {
+		return 0, 0, err
+	}
+	return int(expensesMoved), int(patternsRewritten), nil
+}
+
+// Split creates a curated merchant with the given name and aliases, removes
+// those aliases from the source, and moves the source's expenses and
+// transactions whose raw names normalise to the new merchant's name or aliases.
+// The caller checks the aliases belong to the source and the name is free.
+// It returns the new merchant's ID and how many expenses were moved.
+func Split(q Querier, userID, sourceID uuid.UUID, name string, aliases []string) (uuid.UUID, int, error) {
+	now := time.Now()
+	var newID uuid.UUID
+	err := q.QueryRow(`
+		INSERT INTO merchant_info (user_id, name, aliases, match_keys, auto_created, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, false, $5, $5)
+		RETURNING id
+	`, userID, name, pq.StringArray(aliases), keysOf(name, aliases), now).Scan(&newID)
+	if err != nil {
+		return uuid.Nil, 0, fmt.Errorf("failed to create merchant: %w", err)
+	}
+
+	_, err = q.Exec(`
+		UPDATE merchant_info
+		SET aliases = ARRAY(SELECT alias FROM unnest(aliases) AS alias WHERE alias <> ALL($1)), updated_at = $2
+		WHERE id = $3
+	`, pq.StringArray(aliases), now, sourceID)
+	if err != nil {
+		return uuid.Nil, 0, fmt.Errorf("failed to remove merchant aliases: %w", err)
+	}
+	if err := UpdateKeys(q, sourceID); err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	keys := map[string]bool{Normalize(name): true}
+	for _, alias := range aliases {
+		keys[Normalize(alias)] = true
+	}
+
+	expenseNames, err := matchingNames(q, keys, "SELECT DISTINCT merchant_name FROM expenses WHERE merchant_id = $1 AND merchant_name IS NOT NULL", sourceID)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+	transactionNames, err := matchingNames(q, keys, "SELECT DISTINCT merchant_name FROM transactions WHERE merchant_id = $1 AND merchant_name IS NOT NULL", sourceID)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	expensesMoved := int64(0)
+	if len(expenseNames) > 0 {
+		result, err := q.Exec("UPDATE expenses SET merchant_id = $1, updated_at = $2 WHERE merchant_id = $3 AND merchant_name = ANY($4)", newID, time.Now(), sourceID, pq.Array(expenseNames))
+		if err != nil {
+			return uuid.Nil, 0, fmt.Errorf("failed to move expenses: %w", err)
+		}
+		expensesMoved, _ = result.RowsAffected()
+	}
+	if len(transactionNames) > 0 {
+		_, err := q.Exec("UPDATE transactions SET merchant_id = $1, updated_at = $2 WHERE merchant_id = $3 AND merchant_name = ANY($4)", newID, time.Now(), sourceID, pq.Array(transactionNames))
+		if err != nil {
+			return uuid.Nil, 0, fmt.Errorf("failed to move transactions: %w", err)
+		}
+	}
+
+	if err := Refresh(q, &sourceID, &newID); err != nil {
+		return uuid.Nil, 0, err
+	}
+	return newID, int(expensesMoved), nil
+}
+
+// Refresh recomputes the transaction count, total spent and most common category
+// of the given merchants from their linked expenses. Nil IDs are ignored, so the
+// old and new merchant of an expense can be passed as they are.
+func Refresh(q Querier, merchantIDs ...*uuid.UUID) error {
+	seen := map[uuid.UUID]bool{}
+	for _, id := range merchantIDs {
+		if id == nil || seen[*id] {
+			continue
+		}
+		seen[*id] = true
+
+		// Lock the merchant first so the aggregates below see every expense
+		// committed by writers that held the lock before us
+		var locked uuid.UUID
+		err := q.QueryRow("SELECT id FROM merchant_info WHERE id = $1 FOR UPDATE", *id).Scan(&locked)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock merchant: %w", err)
+		}
+
+		_, err = q.Exec(`
+			UPDATE merchant_info m SET
+				transaction_count = (SELECT COUNT(*) FROM expenses WHERE merchant_id = m.id),
+				total_spent = (SELECT COALESCE(SUM(amount), 0) FROM expenses WHERE merchant_id = m.id),
+				common_category_id = (
+					SELECT category_id FROM expenses WHERE merchant_id = m.id
+					GROUP BY category_id
+					ORDER BY COUNT(*) DESC, MAX(date) DESC
+					LIMIT 1
+				),
+				updated_at = $1
+			WHERE m.id = $2
+		`, time.Now(), *id)
+		if err != nil {
+			return fmt.Errorf("failed to refresh merchant: %w", err)
+		}
+	}
+	return nil
+}
+
+// matchingNames runs a query returning raw merchant names and keeps those whose
+// normalised key is in keys
+func matchingNames(q Querier, keys map[string]bool, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merchant names: %w", err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan merchant name: %w", err)
+		}
+		if keys[Normalize(name)] {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+// keysOf returns the distinct normalised keys of a merchant name and its aliases
+func keysOf(name string, aliases []string) pq.StringArray {
+	keys := pq.StringArray{}
+	seen := map[string]bool{"": true}
+	for _, raw := range append([]string{name}, aliases...) {
+		if key := Normalize(raw); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,90 @@
+package merchant
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// paymentPrefixes are channel markers banks put in front of the merchant name
+var paymentPrefixes = map[string]bool{
+	"POS": true, "UPI": true, "VPS": true, "IPS": true, "ECOM": true, "ECS": true,
+	"NEFT": true, "IMPS": true, "RTGS": true, "ACH": true, "NACH": true, "BIL": true,
+	"ONL": true, "PCD": true, "MPS": true, "SI": true, "TO": true, "AT": true,
+}
+
+// trailingNoise are country code, city and company suffixes that vary between
+// messages from the same merchant. Words that can also end a real name, such as
+// INDIA in "AIR INDIA", are left out.
+var trailingNoise = map[string]bool{
+	"IN": true, "IND": true,
+	"PVT": true, "PRIVATE": true, "LTD": true, "LIMITED": true, "LLP": true, "INC": true, "CO": true, "&": true,
+	"BANGALORE": true, "BENGALURU": true, "MUMBAI": true, "DELHI": true,
+	"CHENNAI": true, "HYDERABAD": true, "PUNE": true, "KOLKATA": true, "GURGAON": true,
+	"GURUGRAM": true, "NOIDA": true, "AHMEDABAD": true, "JAIPUR": true, "KOCHI": true,
+}
+
+// trailingNoisePrefixes are words that are only noise in front of a given suffix,
+// as NEW is in "NEW DELHI"
+var trailingNoisePrefixes = map[string]string{
+	"DELHI": "NEW",
+}
+
+// domainParts matches the www. prefix and top-level domain of a web address. They
+// are only stripped when written as part of one, so COM or NET on their own stay.
+var domainParts = regexp.MustCompile(`(?i)\bwww\.|\.(?:co\.in|com|in|net|org|co)\b`)
+
+// Normalize reduces a raw merchant string from a bank message to a comparison
+// key: upper case, punctuation and reference numbers removed, and payment
+// channel prefixes, web domains and location or company suffixes stripped.
+// For example "AMZN MKTP IN*2K3" becomes "AMZN MKTP" and "amazon.in" becomes
+// "AMAZON". It returns "" for an empty name.
+func Normalize(raw string) string {
+	tokens := strings.FieldsFunc(strings.ToUpper(domainParts.ReplaceAllString(raw, " ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '&'
+	})
+
+	kept := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if isReference(token) {
+			continue
+		}
+		if len(kept) == 0 && paymentPrefixes[token] {
+			continue
+		}
+		kept = append(kept, token)
+	}
+
+	for len(kept) > 1 && trailingNoise[kept[len(kept)-1]] {
+		n := 1
+		if prefix, ok := trailingNoisePrefixes[kept[len(kept)-1]]; ok && kept[len(kept)-2] == prefix {
+			n = 2
+		}
+		if len(kept) == n {
+			break
+		}
+		kept = kept[:len(kept)-n]
+	}
+
+	if len(kept) == 0 {
+		// Everything looked like noise; fall back to the cleaned-up raw text
+		return strings.Join(tokens, " ")
+	}
+	return strings.Join(kept, " ")
+}
+
+// isReference reports whether a token looks like a reference or terminal
+// number rather than part of a name. Short numbers and names with a single
+// digit, as in "7 ELEVEN" or "24 SEVEN", are kept.
+func isReference(token string) bool {
+	digits := 0
+	for _, r := range token {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	if digits == len(token) {
+		return digits >= 3
+	}
+	return digits >= 2
+}
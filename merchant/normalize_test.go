@@ -0,0 +1,45 @@
+package merchant
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "", want: ""},
+		{raw: "  ", want: ""},
+		{raw: "Swiggy", want: "SWIGGY"},
+		{raw: "AMZN MKTP IN*2K3", want: "AMZN MKTP"},
+		{raw: "amazon.in", want: "AMAZON"},
+		{raw: "www.flipkart.com", want: "FLIPKART"},
+		{raw: "swiggy.co.in", want: "SWIGGY"},
+		{raw: "POS 4321 ZOMATO LTD", want: "ZOMATO"},
+		{raw: "UPI/BLINKIT COMMERCE PVT LTD", want: "BLINKIT COMMERCE"},
+		{raw: "Chai Point Bangalore", want: "CHAI POINT"},
+		{raw: "HALDIRAMS NEW DELHI", want: "HALDIRAMS"},
+		{raw: "SHAH & CO", want: "SHAH"},
+		{raw: "M&S", want: "M&S"},
+		{raw: "7 ELEVEN", want: "7 ELEVEN"},
+		{raw: "24 SEVEN 00123", want: "24 SEVEN"},
+		{raw: "NETFLIX 428312345678", want: "NETFLIX"},
+
+		// Words that can end a real name are kept
+		{raw: "BRAND NEW", want: "BRAND NEW"},
+		{raw: "Air India", want: "AIR INDIA"},
+		{raw: "Bank of India", want: "BANK OF INDIA"},
+		{raw: "CAFE COM", want: "CAFE COM"},
+
+		// A name made only of noise is not stripped away entirely
+		{raw: "New Delhi", want: "NEW DELHI"},
+		{raw: "Mumbai", want: "MUMBAI"},
+		{raw: "UPI", want: "UPI"},
+		{raw: "LTD", want: "LTD"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.raw); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
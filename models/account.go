@@ -7,19 +7,22 @@ import (
 )
 
 type Account struct {
-	ID             uuid.UUID `json:"id" db:"id"`
-	UserID         uuid.UUID `json:"userId" db:"user_id"`
-	Name           string    `json:"name" db:"name" binding:"required"`
-	InitialBalance float64   `json:"initialBalance" db:"initial_balance"`
-	CurrentBalance float64   `json:"currentBalance" db:"current_balance"`
-	TotalSpent     float64   `json:"totalSpent" db:"total_spent"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+	ID             uuid.UUID           `json:"id" db:"id"`
+	UserID         uuid.UUID           `json:"userId" db:"user_id"`
+	Name           string              `json:"name" db:"name" binding:"required"`
+	InitialBalance float64             `json:"initialBalance" db:"initial_balance"`
+	CurrentBalance float64             `json:"currentBalance" db:"current_balance"`
+	TotalSpent     float64             `json:"totalSpent" db:"total_spent"`
+	TotalIncome    float64             `json:"totalIncome" db:"total_income"`
+	Identifiers    []AccountIdentifier `json:"identifiers"`
+	CreatedAt      time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time           `json:"updatedAt" db:"updated_at"`
 }
 
 type CreateAccountRequest struct {
-	Name           string  `json:"name" binding:"required"`
-	InitialBalance float64 `json:"initialBalance" binding:"required,min=0"`
+	Name           string                           `json:"name" binding:"required"`
+	InitialBalance float64                          `json:"initialBalance" binding:"required,min=0"`
+	Identifiers    []CreateAccountIdentifierRequest `json:"identifiers" binding:"omitempty,dive"`
 }
 
 type UpdateAccountRequest struct {
@@ -31,5 +34,28 @@ type AccountSummary struct {
 	TotalInitialBalance float64 `json:"totalInitialBalance"`
 	TotalCurrentBalance float64 `json:"totalCurrentBalance"`
 	TotalSpent          float64 `json:"totalSpent"`
+	TotalIncome         float64 `json:"totalIncome"`
 	AccountCount        int     `json:"accountCount"`
 }
+
+// AccountIdentifier ties a payment instrument to an account so parsed
+// transactions can be routed to it
+type AccountIdentifier struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	AccountID uuid.UUID `json:"accountId" db:"account_id"`
+	Type      string    `json:"type" db:"type"`
+	Value     string    `json:"value" db:"value"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type CreateAccountIdentifierRequest struct {
+	Type  string `json:"type" binding:"required,oneof=last4 upi_vpa issuer"`
+	Value string `json:"value" binding:"required"`
+}
+
+// Account identifier types
+const (
+	IdentifierTypeLast4  = "last4"
+	IdentifierTypeUPIVPA = "upi_vpa"
+	IdentifierTypeIssuer = "issuer"
+)
@@ -11,6 +11,7 @@ type Category struct {
 	UserID    *uuid.UUID `json:"userId,omitempty" db:"user_id"`
 	Name      string     `json:"name" db:"name" binding:"required"`
 	Color     string     `json:"color" db:"color" binding:"required,len=7"`
+	Type      string     `json:"type" db:"type"`
 	IsDefault bool       `json:"isDefault" db:"is_default"`
 	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time  `json:"updatedAt" db:"updated_at"`
@@ -19,9 +20,16 @@ type Category struct {
 type CreateCategoryRequest struct {
 	Name  string `json:"name" binding:"required"`
 	Color string `json:"color" binding:"required,len=7"`
+	Type  string `json:"type" binding:"omitempty,oneof=expense income"`
 }
 
 type UpdateCategoryRequest struct {
 	Name  string `json:"name" binding:"required"`
 	Color string `json:"color" binding:"required,len=7"`
 }
+
+// Category types
+const (
+	CategoryTypeExpense = "expense"
+	CategoryTypeIncome  = "income"
+)
@@ -22,6 +22,8 @@ type Expense struct {
 	Verified     bool       `json:"verified" db:"verified"`
 	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`
+	// Suggestion is only set when creating an expense without a merchant at a known place
+	Suggestion *PlaceCategorySuggestion `json:"suggestion,omitempty" db:"-"`
 }
 
 type CreateExpenseRequest struct {
@@ -34,12 +36,13 @@ type CreateExpenseRequest struct {
 }
 
 type UpdateExpenseRequest struct {
-	Amount      *float64   `json:"amount" binding:"omitempty,gt=0"`
-	CategoryID  *uuid.UUID `json:"categoryId"`
-	AccountID   *uuid.UUID `json:"accountId"`
-	Date        *time.Time `json:"date"`
-	Description *string    `json:"description"`
-	Verified    *bool      `json:"verified"`
+	Amount       *float64   `json:"amount" binding:"omitempty,gt=0"`
+	CategoryID   *uuid.UUID `json:"categoryId"`
+	AccountID    *uuid.UUID `json:"accountId"`
+	Date         *time.Time `json:"date"`
+	Description  *string    `json:"description"`
+	MerchantName *string    `json:"merchantName"`
+	Verified     *bool      `json:"verified"`
 }
 
 type BatchExpenseRequest struct {
@@ -48,11 +51,11 @@ type BatchExpenseRequest struct {
 }
 
 type BatchExpenseResponse struct {
-	Success    bool                `json:"success"`
-	Synced     int                 `json:"synced"`
-	Failed     int                 `json:"failed"`
-	Conflicts  int                 `json:"conflicts"`
-	IDMappings map[string]string   `json:"idMappings"`
+	Success    bool              `json:"success"`
+	Synced     int               `json:"synced"`
+	Failed     int               `json:"failed"`
+	Conflicts  int               `json:"conflicts"`
+	IDMappings map[string]string `json:"idMappings"`
 }
 
 type ExpenseListResponse struct {
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Income is money coming into an account, such as salary, refunds or UPI credits
+type Income struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	UserID      uuid.UUID `json:"userId" db:"user_id"`
+	Amount      float64   `json:"amount" db:"amount" binding:"required,gt=0"`
+	CategoryID  uuid.UUID `json:"categoryId" db:"category_id" binding:"required"`
+	AccountID   uuid.UUID `json:"accountId" db:"account_id" binding:"required"`
+	Date        time.Time `json:"date" db:"date" binding:"required"`
+	Description string    `json:"description,omitempty" db:"description"`
+	Source      string    `json:"source" db:"source"`
+	PayerName   string    `json:"payerName,omitempty" db:"payer_name"`
+	RawData     string    `json:"rawData,omitempty" db:"raw_data"`
+	Verified    bool      `json:"verified" db:"verified"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type CreateIncomeRequest struct {
+	Amount      float64   `json:"amount" binding:"required,gt=0"`
+	CategoryID  uuid.UUID `json:"categoryId" binding:"required"`
+	AccountID   uuid.UUID `json:"accountId" binding:"required"`
+	Date        time.Time `json:"date" binding:"required"`
+	Description string    `json:"description"`
+	PayerName   string    `json:"payerName"`
+}
+
+type UpdateIncomeRequest struct {
+	Amount      *float64   `json:"amount" binding:"omitempty,gt=0"`
+	CategoryID  *uuid.UUID `json:"categoryId"`
+	Date        *time.Time `json:"date"`
+	Description *string    `json:"description"`
+	PayerName   *string    `json:"payerName"`
+	Verified    *bool      `json:"verified"`
+}
@@ -7,21 +7,37 @@ import (
 )
 
 type Location struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	UserID    uuid.UUID `json:"userId" db:"user_id"`
-	Latitude  float64   `json:"latitude" db:"latitude" binding:"required"`
-	Longitude float64   `json:"longitude" db:"longitude" binding:"required"`
-	Timestamp time.Time `json:"timestamp" db:"timestamp" binding:"required"`
-	Address   string    `json:"address,omitempty" db:"address"`
-	Accuracy  float64   `json:"accuracy,omitempty" db:"accuracy"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"userId" db:"user_id"`
+	Latitude  float64    `json:"latitude" db:"latitude"`
+	Longitude float64    `json:"longitude" db:"longitude"`
+	Timestamp time.Time  `json:"timestamp" db:"timestamp" binding:"required"`
+	Address   string     `json:"address,omitempty" db:"address"`
+	Accuracy  float64    `json:"accuracy,omitempty" db:"accuracy"`
+	PlaceID   *uuid.UUID `json:"placeId,omitempty" db:"place_id"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
 }
 
+// CreateLocationRequest is a location fix from the phone. Accuracy is the
+// radius in metres; 0 or omitted means it is unknown.
 type CreateLocationRequest struct {
-	Latitude  float64   `json:"latitude" binding:"required"`
-	Longitude float64   `json:"longitude" binding:"required"`
+	Latitude  *float64  `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64  `json:"longitude" binding:"required,min=-180,max=180"`
 	Timestamp time.Time `json:"timestamp" binding:"required"`
-	Accuracy  float64   `json:"accuracy"`
+	Accuracy  float64   `json:"accuracy" binding:"gte=0"`
+}
+
+type BatchLocationRequest struct {
+	Locations []CreateLocationRequest `json:"locations" binding:"required,min=1,max=1000,dive"`
+}
+
+// BatchLocationResponse reports the stored fixes and how many expenses and
+// transactions without a location were linked to them
+type BatchLocationResponse struct {
+	Created            int        `json:"created"`
+	Locations          []Location `json:"locations"`
+	LinkedExpenses     int64      `json:"linkedExpenses"`
+	LinkedTransactions int64      `json:"linkedTransactions"`
 }
 
 type LocationExpensesResponse struct {
@@ -29,3 +45,65 @@ type LocationExpensesResponse struct {
 	Expenses   []Expense `json:"expenses"`
 	TotalSpent float64   `json:"totalSpent"`
 }
+
+// Place is a cluster of the user's location fixes. TotalSpent and
+// ExpenseCount cover the expenses linked to its fixes in the period asked for.
+type Place struct {
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	UserID             uuid.UUID  `json:"userId" db:"user_id"`
+	Name               *string    `json:"name" db:"name"`
+	Latitude           float64    `json:"latitude" db:"latitude"`
+	Longitude          float64    `json:"longitude" db:"longitude"`
+	Radius             float64    `json:"radius" db:"radius"`
+	FixCount           int        `json:"fixCount" db:"fix_count"`
+	TotalSpent         float64    `json:"totalSpent"`
+	ExpenseCount       int        `json:"expenseCount"`
+	DominantCategoryID *uuid.UUID `json:"dominantCategoryId"`
+	CreatedAt          time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+// UpdatePlaceRequest names a place; an empty name clears it
+type UpdatePlaceRequest struct {
+	Name *string `json:"name" binding:"required,max=255"`
+}
+
+type PlaceExpensesResponse struct {
+	Place        Place     `json:"place"`
+	Expenses     []Expense `json:"expenses"`
+	TotalSpent   float64   `json:"totalSpent"`
+	ExpenseCount int       `json:"expenseCount"`
+}
+
+type RebuildPlacesResponse struct {
+	Places int `json:"places"`
+}
+
+// PlaceCategorySuggestion offers the category most of the user's verified
+// expenses at a place have, for an expense there without a merchant
+type PlaceCategorySuggestion struct {
+	PlaceID      uuid.UUID `json:"placeId"`
+	PlaceName    string    `json:"placeName,omitempty"`
+	CategoryID   uuid.UUID `json:"categoryId"`
+	ExpenseCount int       `json:"expenseCount"`
+	Share        float64   `json:"share"`
+}
+
+// GeoJSONFeatureCollection is a GeoJSON (RFC 7946) document for map tools
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	BBox       []float64              `json:"bbox,omitempty"`
+	Geometry   GeoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONPoint holds its coordinates as longitude then latitude
+type GeoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
@@ -15,6 +15,7 @@ type MerchantInfo struct {
 	CommonCategoryID *uuid.UUID     `json:"commonCategoryId,omitempty" db:"common_category_id"`
 	TransactionCount int            `json:"transactionCount" db:"transaction_count"`
 	TotalSpent       float64        `json:"totalSpent" db:"total_spent"`
+	AutoCreated      bool           `json:"autoCreated" db:"auto_created"`
 	CreatedAt        time.Time      `json:"createdAt" db:"created_at"`
 	UpdatedAt        time.Time      `json:"updatedAt" db:"updated_at"`
 }
@@ -24,6 +25,40 @@ type CreateMerchantRequest struct {
 	Aliases []string `json:"aliases"`
 }
 
+type AddMerchantAliasRequest struct {
+	Alias string `json:"alias" binding:"required"`
+}
+
+// UnresolvedMerchantName groups raw merchant names that normalise to the same
+// key but are not yet attached to a merchant the user curated
+type UnresolvedMerchantName struct {
+	Name     string    `json:"name"`
+	RawNames []string  `json:"rawNames"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+type MergeMerchantRequest struct {
+	TargetID uuid.UUID `json:"targetId" binding:"required"`
+}
+
+type MergeMerchantResponse struct {
+	Merchant          MerchantInfo `json:"merchant"`
+	ExpensesMoved     int          `json:"expensesMoved"`
+	PatternsRewritten int          `json:"patternsRewritten"`
+}
+
+type SplitMerchantRequest struct {
+	Name    string   `json:"name" binding:"required"`
+	Aliases []string `json:"aliases" binding:"required,min=1"`
+}
+
+type SplitMerchantResponse struct {
+	Merchant      MerchantInfo `json:"merchant"`
+	NewMerchant   MerchantInfo `json:"newMerchant"`
+	ExpensesMoved int          `json:"expensesMoved"`
+}
+
 type MerchantExpensesResponse struct {
 	Merchant     MerchantInfo `json:"merchant"`
 	Expenses     []Expense    `json:"expenses"`
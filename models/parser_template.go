@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/parser"
+)
+
+type ParserTemplate struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	UserID      uuid.UUID `json:"userId" db:"user_id"`
+	Name        string    `json:"name" db:"name"`
+	SenderMatch string    `json:"senderMatch,omitempty" db:"sender_match"`
+	Pattern     string    `json:"pattern" db:"pattern"`
+	Direction   string    `json:"direction" db:"direction"`
+	Priority    int       `json:"priority" db:"priority"`
+	IsActive    bool      `json:"isActive" db:"is_active"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type CreateParserTemplateRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	SenderMatch string `json:"senderMatch" binding:"max=255"`
+	Pattern     string `json:"pattern" binding:"required"`
+	Direction   string `json:"direction" binding:"required,oneof=debit credit"`
+	Priority    int    `json:"priority"`
+}
+
+type UpdateParserTemplateRequest struct {
+	Name        *string `json:"name" binding:"omitempty,max=100"`
+	SenderMatch *string `json:"senderMatch" binding:"omitempty,max=255"`
+	Pattern     *string `json:"pattern"`
+	Direction   *string `json:"direction" binding:"omitempty,oneof=debit credit"`
+	Priority    *int    `json:"priority"`
+	IsActive    *bool   `json:"isActive"`
+}
+
+// TestParserTemplateRequest runs either a stored template (templateId) or an
+// unsaved one (pattern, direction, senderMatch) against sample text
+type TestParserTemplateRequest struct {
+	TemplateID  *uuid.UUID `json:"templateId"`
+	SenderMatch string     `json:"senderMatch"`
+	Pattern     string     `json:"pattern"`
+	Direction   string     `json:"direction" binding:"omitempty,oneof=debit credit"`
+	RawText     string     `json:"rawText" binding:"required"`
+	SenderInfo  string     `json:"senderInfo"`
+}
+
+type TestParserTemplateResponse struct {
+	Matched       bool           `json:"matched"`
+	SenderMatched bool           `json:"senderMatched"`
+	Result        *parser.Result `json:"result"`
+}
+
+type ReparseTransactionsResponse struct {
+	Checked    int `json:"checked"`
+	Parsed     int `json:"parsed"`
+	Duplicates int `json:"duplicates"`
+}
@@ -7,35 +7,223 @@ import (
 )
 
 type MerchantPattern struct {
-	ID           uuid.UUID  `json:"id" db:"id"`
-	UserID       uuid.UUID  `json:"userId" db:"user_id"`
-	MerchantName string     `json:"merchantName" db:"merchant_name" binding:"required"`
-	CategoryID   uuid.UUID  `json:"categoryId" db:"category_id" binding:"required"`
-	MatchType    string     `json:"matchType" db:"match_type"`
-	IsActive     bool       `json:"isActive" db:"is_active"`
-	UseCount     int        `json:"useCount" db:"use_count"`
-	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
-	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
-	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`
+	ID           uuid.UUID `json:"id" db:"id"`
+	UserID       uuid.UUID `json:"userId" db:"user_id"`
+	MerchantName string    `json:"merchantName" db:"merchant_name" binding:"required"`
+	CategoryID   uuid.UUID `json:"categoryId" db:"category_id" binding:"required"`
+	MatchType    string    `json:"matchType" db:"match_type"`
+	Priority     int       `json:"priority" db:"priority"`
+	// FuzzyThreshold is the similarity a fuzzy pattern needs to match, from 0 to 1
+	FuzzyThreshold *float64   `json:"fuzzyThreshold,omitempty" db:"fuzzy_threshold"`
+	IsActive       bool       `json:"isActive" db:"is_active"`
+	UseCount       int        `json:"useCount" db:"use_count"`
+	LastUsedAt     *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
 }
 
+// Match types of a merchant pattern
+const (
+	MatchTypeExact      = "exact"
+	MatchTypeContains   = "contains"
+	MatchTypeStartsWith = "starts_with"
+	MatchTypeEndsWith   = "ends_with"
+	MatchTypeWord       = "word"
+	MatchTypeRegex      = "regex"
+	MatchTypeFuzzy      = "fuzzy"
+)
+
 type CreatePatternRequest struct {
-	MerchantName string    `json:"merchantName" binding:"required"`
-	CategoryID   uuid.UUID `json:"categoryId" binding:"required"`
-	MatchType    string    `json:"matchType" binding:"required,oneof=exact contains"`
+	MerchantName   string    `json:"merchantName" binding:"required"`
+	CategoryID     uuid.UUID `json:"categoryId" binding:"required"`
+	MatchType      string    `json:"matchType" binding:"required,oneof=exact contains starts_with ends_with word regex fuzzy"`
+	Priority       int       `json:"priority"`
+	FuzzyThreshold *float64  `json:"fuzzyThreshold" binding:"omitempty,gt=0,lte=1"`
 }
 
 type UpdatePatternRequest struct {
-	CategoryID *uuid.UUID `json:"categoryId"`
-	MatchType  *string    `json:"matchType" binding:"omitempty,oneof=exact contains"`
-	IsActive   *bool      `json:"isActive"`
+	CategoryID     *uuid.UUID `json:"categoryId"`
+	MatchType      *string    `json:"matchType" binding:"omitempty,oneof=exact contains starts_with ends_with word regex fuzzy"`
+	Priority       *int       `json:"priority"`
+	FuzzyThreshold *float64   `json:"fuzzyThreshold" binding:"omitempty,gt=0,lte=1"`
+	IsActive       *bool      `json:"isActive"`
 }
 
 type MatchPatternRequest struct {
 	MerchantName string `json:"merchantName" binding:"required"`
 }
 
+// MatchPatternResponse carries the winning pattern, how similar the name is to
+// it (1 unless it is a fuzzy pattern) and the other patterns that matched, in
+// order of precedence
 type MatchPatternResponse struct {
-	Matched bool             `json:"matched"`
-	Pattern *MerchantPattern `json:"pattern"`
+	Matched    bool               `json:"matched"`
+	Pattern    *MerchantPattern   `json:"pattern"`
+	Score      float64            `json:"score"`
+	Candidates []PatternCandidate `json:"candidates"`
+}
+
+// PatternCandidate is a pattern that matched a name, with its similarity score
+type PatternCandidate struct {
+	Pattern MerchantPattern `json:"pattern"`
+	Score   float64         `json:"score"`
+}
+
+type BatchMatchPatternRequest struct {
+	MerchantNames []string `json:"merchantNames" binding:"required,min=1,max=1000"`
+}
+
+// BatchMatchPatternResult is the outcome of matching one name of a batch
+type BatchMatchPatternResult struct {
+	MerchantName string           `json:"merchantName"`
+	Matched      bool             `json:"matched"`
+	Pattern      *MerchantPattern `json:"pattern"`
+	Score        float64          `json:"score"`
+}
+
+// PatternSuggestion is a pattern proposed from the user's verified expenses
+type PatternSuggestion struct {
+	MerchantName string    `json:"merchantName"`
+	MatchType    string    `json:"matchType"`
+	CategoryID   uuid.UUID `json:"categoryId"`
+	CategoryName string    `json:"categoryName"`
+	Priority     int       `json:"priority"`
+	Confidence   float64   `json:"confidence"`
+	Support      int       `json:"support"`
+	Examples     []string  `json:"examples"`
+}
+
+type AcceptPatternSuggestionsRequest struct {
+	Suggestions []CreatePatternRequest `json:"suggestions" binding:"required,min=1,max=200,dive"`
+}
+
+// AcceptPatternSuggestionsResponse lists the patterns created and the names
+// skipped because a pattern for them already exists
+type AcceptPatternSuggestionsResponse struct {
+	Created []MerchantPattern `json:"created"`
+	Skipped []string          `json:"skipped"`
+}
+
+// ApplyPatternRequest selects the existing expenses a pattern is applied to.
+// DryRun defaults to true.
+type ApplyPatternRequest struct {
+	DryRun         *bool  `json:"dryRun"`
+	UnverifiedOnly bool   `json:"unverifiedOnly"`
+	StartDate      string `json:"startDate"`
+	EndDate        string `json:"endDate"`
+}
+
+// PatternApplyChange is an expense a pattern moves to its category
+type PatternApplyChange struct {
+	ExpenseID      uuid.UUID `json:"expenseId"`
+	MerchantName   string    `json:"merchantName"`
+	Amount         float64   `json:"amount"`
+	Date           time.Time `json:"date"`
+	Verified       bool      `json:"verified"`
+	FromCategoryID uuid.UUID `json:"fromCategoryId"`
+	ToCategoryID   uuid.UUID `json:"toCategoryId"`
+}
+
+// ApplyPatternResponse lists the changes a pattern makes to existing expenses.
+// Shadowed counts matching expenses that another pattern takes precedence for.
+type ApplyPatternResponse struct {
+	DryRun   bool                 `json:"dryRun"`
+	Changes  []PatternApplyChange `json:"changes"`
+	Updated  int                  `json:"updated"`
+	Shadowed int                  `json:"shadowed"`
+}
+
+// PatternPack is the portable export format of a user's merchant patterns
+type PatternPack struct {
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exportedAt"`
+	Patterns   []PatternPackEntry `json:"patterns"`
+}
+
+// PatternPackEntry is a pattern in a pack, with its category given by name.
+// IsActive defaults to true when left out.
+type PatternPackEntry struct {
+	MerchantName   string   `json:"merchantName"`
+	MatchType      string   `json:"matchType"`
+	Category       string   `json:"category"`
+	Priority       int      `json:"priority"`
+	FuzzyThreshold *float64 `json:"fuzzyThreshold,omitempty"`
+	IsActive       *bool    `json:"isActive,omitempty"`
+}
+
+// How an import handles a pattern whose merchant name the user already has
+const (
+	ImportConflictSkip      = "skip"
+	ImportConflictOverwrite = "overwrite"
+	ImportConflictRename    = "rename"
+)
+
+// What an import did with a pattern
+const (
+	ImportStatusCreated = "created"
+	ImportStatusUpdated = "updated"
+	ImportStatusRenamed = "renamed"
+	ImportStatusSkipped = "skipped"
+	ImportStatusInvalid = "invalid"
+)
+
+// PatternImportResult reports the outcome for one pattern of a pack.
+// ExistingPatternID is set when the name conflicted with an existing pattern.
+type PatternImportResult struct {
+	MerchantName      string     `json:"merchantName"`
+	Status            string     `json:"status"`
+	ImportedAs        string     `json:"importedAs,omitempty"`
+	PatternID         *uuid.UUID `json:"patternId,omitempty"`
+	ExistingPatternID *uuid.UUID `json:"existingPatternId,omitempty"`
+	Error             string     `json:"error,omitempty"`
+}
+
+// ImportPatternsResponse summarises an import, with one result per pattern in pack order
+type ImportPatternsResponse struct {
+	DryRun   bool                  `json:"dryRun"`
+	Conflict string                `json:"conflict"`
+	Created  int                   `json:"created"`
+	Updated  int                   `json:"updated"`
+	Renamed  int                   `json:"renamed"`
+	Skipped  int                   `json:"skipped"`
+	Invalid  int                   `json:"invalid"`
+	Results  []PatternImportResult `json:"results"`
+}
+
+// PatternConflict describes two active patterns that both match the same
+// merchant name but assign different categories
+type PatternConflict struct {
+	Patterns   []MerchantPattern `json:"patterns"`
+	Example    string            `json:"example"`
+	WinnerID   uuid.UUID         `json:"winnerId"`
+	ResolvedBy string            `json:"resolvedBy"`
+}
+
+// How a pattern conflict is settled by the matcher
+const (
+	ConflictResolvedByPriority    = "priority"
+	ConflictResolvedBySpecificity = "specificity"
+	ConflictResolvedByOrder       = "order"
+)
+
+// Where a pattern match was recorded from
+const (
+	PatternMatchSourceMatch = "match"
+	PatternMatchSourceAuto  = "auto"
+)
+
+// PatternStats summarises how a pattern has been used over a period
+type PatternStats struct {
+	Pattern      MerchantPattern     `json:"pattern"`
+	Matches      int                 `json:"matches"`
+	Categorised  int                 `json:"categorised"`
+	Overridden   int                 `json:"overridden"`
+	OverrideRate float64             `json:"overrideRate"`
+	Series       []PatternStatsPoint `json:"series"`
+}
+
+// PatternStatsPoint is the number of matches of a pattern in one interval
+type PatternStatsPoint struct {
+	Period  time.Time `json:"period"`
+	Matches int       `json:"matches"`
 }
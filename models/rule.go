@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Rule sets fields of an expense when all of its conditions hold. Active rules
+// run in position order, and a rule with StopProcessing set ends the run when
+// it fires.
+type Rule struct {
+	ID             uuid.UUID      `json:"id" db:"id"`
+	UserID         uuid.UUID      `json:"userId" db:"user_id"`
+	Name           string         `json:"name" db:"name"`
+	Position       int            `json:"position" db:"position"`
+	IsActive       bool           `json:"isActive" db:"is_active"`
+	StopProcessing bool           `json:"stopProcessing" db:"stop_processing"`
+	Conditions     RuleConditions `json:"conditions"`
+	Actions        RuleActions    `json:"actions"`
+	UseCount       int            `json:"useCount" db:"use_count"`
+	LastUsedAt     *time.Time     `json:"lastUsedAt,omitempty" db:"last_used_at"`
+	CreatedAt      time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// RuleConditions are the optional tests of a rule. Days of week run from 0
+// (Sunday) to 6, and a description keyword matches case-insensitively
+// anywhere in the description or, for ingested expenses, the bank message.
+type RuleConditions struct {
+	MerchantName        *string        `json:"merchantName,omitempty" db:"merchant_name"`
+	MerchantMatchType   *string        `json:"merchantMatchType,omitempty" db:"merchant_match_type" binding:"omitempty,oneof=exact contains starts_with ends_with word regex"`
+	MinAmount           *float64       `json:"minAmount,omitempty" db:"min_amount" binding:"omitempty,gte=0"`
+	MaxAmount           *float64       `json:"maxAmount,omitempty" db:"max_amount" binding:"omitempty,gte=0"`
+	AccountID           *uuid.UUID     `json:"accountId,omitempty" db:"account_id"`
+	DaysOfWeek          pq.Int64Array  `json:"daysOfWeek,omitempty" db:"days_of_week" binding:"omitempty,dive,min=0,max=6"`
+	Source              *string        `json:"source,omitempty" db:"source" binding:"omitempty,oneof=manual auto"`
+	DescriptionKeywords pq.StringArray `json:"descriptionKeywords,omitempty" db:"description_keywords"`
+}
+
+// RuleActions are the fields a rule sets when it fires
+type RuleActions struct {
+	CategoryID  *uuid.UUID `json:"categoryId,omitempty" db:"set_category_id"`
+	Description *string    `json:"description,omitempty" db:"set_description"`
+	Verified    *bool      `json:"verified,omitempty" db:"set_verified"`
+}
+
+// CreateRuleRequest defines a rule. Updates take the same body and replace the
+// rule's conditions and actions. Without a position the rule goes last.
+type CreateRuleRequest struct {
+	Name           string         `json:"name" binding:"required,max=100"`
+	Position       *int           `json:"position" binding:"omitempty,gte=0"`
+	IsActive       *bool          `json:"isActive"`
+	StopProcessing *bool          `json:"stopProcessing"`
+	Conditions     RuleConditions `json:"conditions"`
+	Actions        RuleActions    `json:"actions"`
+}
+
+type ReorderRulesRequest struct {
+	RuleIDs []uuid.UUID `json:"ruleIds" binding:"required,min=1"`
+}
+
+// TestRuleRequest describes an expense to run the rules against
+type TestRuleRequest struct {
+	MerchantName string     `json:"merchantName"`
+	Amount       float64    `json:"amount" binding:"required,gt=0"`
+	AccountID    *uuid.UUID `json:"accountId"`
+	Date         *time.Time `json:"date"`
+	Source       string     `json:"source" binding:"omitempty,oneof=manual auto"`
+	Description  string     `json:"description"`
+	RawText      string     `json:"rawText"`
+}
+
+// RuleTrace explains what one rule did during a run. Reason names the first
+// condition that failed when the rule did not fire.
+type RuleTrace struct {
+	RuleID  uuid.UUID `json:"ruleId"`
+	Name    string    `json:"name"`
+	Fired   bool      `json:"fired"`
+	Reason  string    `json:"reason,omitempty"`
+	Stopped bool      `json:"stopped"`
+}
+
+// RuleEvaluation is the outcome of running a user's rules against an expense.
+// Fields left nil were not set by any rule. The rule IDs name the rule whose
+// action set each field, which is the last one to fire with that action.
+type RuleEvaluation struct {
+	CategoryID        *uuid.UUID  `json:"categoryId"`
+	Description       *string     `json:"description"`
+	Verified          *bool       `json:"verified"`
+	CategoryRuleID    *uuid.UUID  `json:"categoryRuleId,omitempty"`
+	DescriptionRuleID *uuid.UUID  `json:"descriptionRuleId,omitempty"`
+	VerifiedRuleID    *uuid.UUID  `json:"verifiedRuleId,omitempty"`
+	Trace             []RuleTrace `json:"trace"`
+}
+
+// TestRuleResponse shows the merchant pattern that matched, if any, and the
+// fields the expense would end up with after the rules ran. CategoryID is nil
+// when neither a pattern nor a rule picked a category.
+type TestRuleResponse struct {
+	Pattern     *MerchantPattern `json:"pattern"`
+	CategoryID  *uuid.UUID       `json:"categoryId"`
+	Description *string          `json:"description"`
+	Verified    *bool            `json:"verified"`
+	Trace       []RuleTrace      `json:"trace"`
+}
@@ -38,10 +38,44 @@ type RegisterDeviceRequest struct {
 	DeviceName string `json:"deviceName" binding:"required"`
 }
 
+// IncrementalSyncRequest carries the changes a device made since it last
+// synced. Without a lastSyncTimestamp, every record of the user is sent back.
 type IncrementalSyncRequest struct {
-	DeviceID          string                    `json:"deviceId" binding:"required"`
-	LastSyncTimestamp *time.Time                `json:"lastSyncTimestamp"`
-	Changes           IncrementalSyncChanges    `json:"changes"`
+	DeviceID          string                      `json:"deviceId" binding:"required,max=255"`
+	LastSyncTimestamp *time.Time                  `json:"lastSyncTimestamp"`
+	Changes           IncrementalSyncLocalChanges `json:"changes"`
+}
+
+// IncrementalSyncLocalChanges are records as a device sends them, under the
+// device's own IDs for records the server has not seen yet
+type IncrementalSyncLocalChanges struct {
+	Transactions     []SyncTransaction     `json:"transactions" binding:"max=1000"`
+	Expenses         []SyncExpense         `json:"expenses" binding:"max=1000"`
+	MerchantPatterns []SyncMerchantPattern `json:"merchantPatterns" binding:"max=1000"`
+}
+
+// SyncTransaction is a transaction the device stored. ExpenseID names the
+// expense the device created from it, by local or server ID.
+type SyncTransaction struct {
+	Transaction
+	ID        string `json:"id"`
+	ExpenseID string `json:"expenseId"`
+}
+
+// SyncExpense is an expense the device created, changed or, with Deleted, removed
+type SyncExpense struct {
+	Expense
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+// SyncMerchantPattern is a pattern the device created, changed or, with Deleted,
+// removed. A new pattern is active unless isActive is false.
+type SyncMerchantPattern struct {
+	MerchantPattern
+	ID       string `json:"id"`
+	IsActive *bool  `json:"isActive"`
+	Deleted  bool   `json:"deleted"`
 }
 
 type IncrementalSyncChanges struct {
@@ -56,8 +90,24 @@ type IncrementalSyncResponse struct {
 	Conflicts     []SyncConflict            `json:"conflicts"`
 	IDMappings    SyncIDMappings            `json:"idMappings"`
 	ServerChanges IncrementalSyncChanges    `json:"serverChanges"`
+	// HasMore is set when serverChanges was cut short; sync again from syncTimestamp for the rest
+	HasMore       bool                      `json:"hasMore"`
 }
 
+// Sync record types, as named in conflicts
+const (
+	SyncTypeTransaction     = "transaction"
+	SyncTypeExpense         = "expense"
+	SyncTypeMerchantPattern = "merchantPattern"
+)
+
+// How a conflict was resolved
+const (
+	SyncResolutionServerWins = "server_wins"
+	SyncResolutionClientWins = "client_wins"
+	SyncResolutionRejected   = "rejected"
+)
+
 type SyncConflict struct {
 	Type       string `json:"type"`
 	LocalID    string `json:"localId"`
@@ -79,3 +129,19 @@ type UpdateSyncStatusRequest struct {
 	PendingCount      int    `json:"pendingCount"`
 	ConflictsResolved int    `json:"conflictsResolved"`
 }
+
+// Change is an entry in a user's change log
+type Change struct {
+	Seq        int64     `json:"seq" db:"seq"`
+	EntityType string    `json:"entityType" db:"entity_type"`
+	EntityID   uuid.UUID `json:"entityId" db:"entity_id"`
+	Operation  string    `json:"operation" db:"operation"`
+	ChangedAt  time.Time `json:"changedAt" db:"changed_at"`
+}
+
+type ChangesResponse struct {
+	Changes []Change `json:"changes"`
+	// NextSince is the since to ask for the next page with
+	NextSince int64 `json:"nextSince"`
+	HasMore   bool  `json:"hasMore"`
+}
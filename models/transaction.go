@@ -7,26 +7,42 @@ import (
 )
 
 type Transaction struct {
-	ID           uuid.UUID  `json:"id" db:"id"`
-	UserID       uuid.UUID  `json:"userId" db:"user_id"`
-	RawText      string     `json:"rawText" db:"raw_text" binding:"required"`
-	Timestamp    time.Time  `json:"timestamp" db:"timestamp" binding:"required"`
-	SenderInfo   string     `json:"senderInfo,omitempty" db:"sender_info"`
-	Amount       *float64   `json:"amount,omitempty" db:"amount"`
-	MerchantName string     `json:"merchantName,omitempty" db:"merchant_name"`
-	AccountLast4 string     `json:"accountLast4,omitempty" db:"account_last4"`
-	Parsed       bool       `json:"parsed" db:"parsed"`
-	Processed    bool       `json:"processed" db:"processed"`
-	ExpenseID    *uuid.UUID `json:"expenseId,omitempty" db:"expense_id"`
-	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
+	ID               uuid.UUID  `json:"id" db:"id"`
+	UserID           uuid.UUID  `json:"userId" db:"user_id"`
+	RawText          string     `json:"rawText" db:"raw_text" binding:"required"`
+	Timestamp        time.Time  `json:"timestamp" db:"timestamp" binding:"required"`
+	SenderInfo       string     `json:"senderInfo,omitempty" db:"sender_info"`
+	Amount           *float64   `json:"amount,omitempty" db:"amount"`
+	MerchantName     string     `json:"merchantName,omitempty" db:"merchant_name"`
+	MerchantID       *uuid.UUID `json:"merchantId,omitempty" db:"merchant_id"`
+	AccountLast4     string     `json:"accountLast4,omitempty" db:"account_last4"`
+	Bank             string     `json:"bank,omitempty" db:"bank"`
+	Direction        string     `json:"direction,omitempty" db:"direction"`
+	ReferenceNumber  string     `json:"referenceNumber,omitempty" db:"reference_number"`
+	ParseTemplate    string     `json:"parseTemplate,omitempty" db:"parse_template"`
+	Parsed           bool       `json:"parsed" db:"parsed"`
+	Processed        bool       `json:"processed" db:"processed"`
+	ExpenseID        *uuid.UUID `json:"expenseId,omitempty" db:"expense_id"`
+	IncomeID         *uuid.UUID `json:"incomeId,omitempty" db:"income_id"`
+	DeviceID         string     `json:"deviceId,omitempty" db:"device_id"`
+	LocationID       *uuid.UUID `json:"locationId,omitempty" db:"location_id"`
+	Fingerprint      string     `json:"-" db:"fingerprint"`
+	DuplicateOf      *uuid.UUID `json:"duplicateOf,omitempty" db:"duplicate_of"`
+	DuplicateStatus  string     `json:"duplicateStatus,omitempty" db:"duplicate_status"`
+	DuplicateReason  string     `json:"duplicateReason,omitempty" db:"duplicate_reason"`
+	UnassignedReason string     `json:"unassignedReason,omitempty" db:"unassigned_reason"`
+	CreatedAt        time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updatedAt" db:"updated_at"`
 }
 
 type CreateTransactionRequest struct {
 	RawText      string    `json:"rawText" binding:"required"`
 	Timestamp    time.Time `json:"timestamp" binding:"required"`
 	SenderInfo   string    `json:"senderInfo"`
-	Amount       float64   `json:"amount"`
+	Amount       float64   `json:"amount" binding:"omitempty,gt=0"`
 	MerchantName string    `json:"merchantName"`
+	AccountLast4 string    `json:"accountLast4" binding:"omitempty,len=4,numeric"`
+	DeviceID     string    `json:"deviceId"`
 }
 
 type BatchTransactionRequest struct {
@@ -35,13 +51,79 @@ type BatchTransactionRequest struct {
 }
 
 type BatchTransactionResponse struct {
-	Success        bool     `json:"success"`
-	Processed      int      `json:"processed"`
-	Failed         int      `json:"failed"`
-	TransactionIDs []string `json:"transactionIds"`
+	Success        bool                     `json:"success"`
+	Processed      int                      `json:"processed"`
+	Failed         int                      `json:"failed"`
+	Duplicates     int                      `json:"duplicates"`
+	TransactionIDs []string                 `json:"transactionIds"`
+	Results        []BatchTransactionResult `json:"results"`
+}
+
+// BatchTransactionResult reports the outcome for a single item of a batch upload
+type BatchTransactionResult struct {
+	Index         int    `json:"index"`
+	Success       bool   `json:"success"`
+	TransactionID string `json:"transactionId,omitempty"`
+	ExpenseID     string `json:"expenseId,omitempty"`
+	IncomeID      string `json:"incomeId,omitempty"`
+	Duplicate     bool   `json:"duplicate,omitempty"`
+	DuplicateOf   string `json:"duplicateOf,omitempty"`
+	Error         string `json:"error,omitempty"`
 }
 
 type TransactionListResponse struct {
 	Transactions []Transaction `json:"transactions"`
 	Total        int           `json:"total"`
 }
+
+// DuplicateTransactionPair shows a transaction linked as a duplicate next to its original
+type DuplicateTransactionPair struct {
+	Duplicate Transaction `json:"duplicate"`
+	Original  Transaction `json:"original"`
+}
+
+// UnparsedSenderSummary groups transactions the parser could not handle by sender
+type UnparsedSenderSummary struct {
+	SenderInfo string    `json:"senderInfo"`
+	Count      int       `json:"count"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	SampleText string    `json:"sampleText"`
+}
+
+// TransactionProcessResult reports what the processing pipeline did with a transaction
+type TransactionProcessResult struct {
+	TransactionID uuid.UUID  `json:"transactionId"`
+	Status        string     `json:"status"`
+	ExpenseID     *uuid.UUID `json:"expenseId,omitempty"`
+	IncomeID      *uuid.UUID `json:"incomeId,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	// Suggestion is a category for an expense without a merchant, from the place it was made at
+	Suggestion *PlaceCategorySuggestion `json:"suggestion,omitempty"`
+}
+
+// Processing statuses. Unassigned transactions are waiting for the user to pick an account.
+const (
+	ProcessStatusCreated          = "created"
+	ProcessStatusAlreadyProcessed = "already_processed"
+	ProcessStatusSkipped          = "skipped"
+	ProcessStatusUnassigned       = "unassigned"
+)
+
+// Duplicate review statuses. A rejected link is kept for reference but the
+// transaction is otherwise treated as an original.
+const (
+	DuplicateStatusLinked    = "linked"
+	DuplicateStatusConfirmed = "confirmed"
+	DuplicateStatusRejected  = "rejected"
+)
+
+// IsDuplicate reports whether the transaction is linked to an original it repeats
+func (t Transaction) IsDuplicate() bool {
+	return t.DuplicateOf != nil && t.DuplicateStatus != DuplicateStatusRejected
+}
+
+// AssignTransactionRequest picks the account for a transaction the resolver could not place
+type AssignTransactionRequest struct {
+	AccountID          uuid.UUID `json:"accountId" binding:"required"`
+	RememberIdentifier bool      `json:"rememberIdentifier"`
+}
@@ -0,0 +1,230 @@
+// Package parser extracts structured transaction details from raw bank
+// SMS and app notification text.
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Transaction directions
+const (
+	DirectionDebit  = "debit"
+	DirectionCredit = "credit"
+)
+
+// Named capture groups recognised in template patterns
+const (
+	GroupAmount    = "amount"
+	GroupMerchant  = "merchant"
+	GroupLast4     = "last4"
+	GroupReference = "ref"
+	GroupBalance   = "balance"
+)
+
+// Template describes one message format. Senders are case-insensitive
+// substrings of the notification sender; a template without senders is
+// tried against every message after the sender-specific ones.
+type Template struct {
+	Name      string   `json:"name"`
+	Bank      string   `json:"bank"`
+	Senders   []string `json:"senders"`
+	Direction string   `json:"direction"`
+	Pattern   string   `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// Result holds the fields extracted from a message
+type Result struct {
+	Template        string   `json:"template"`
+	Bank            string   `json:"bank,omitempty"`
+	Direction       string   `json:"direction"`
+	Amount          float64  `json:"amount"`
+	MerchantName    string   `json:"merchantName,omitempty"`
+	AccountLast4    string   `json:"accountLast4,omitempty"`
+	ReferenceNumber string   `json:"referenceNumber,omitempty"`
+	Balance         *float64 `json:"balance,omitempty"`
+}
+
+// NewTemplate builds and compiles a template from user-supplied fields.
+// senderMatch is a comma-separated list of sender substrings.
+func NewTemplate(name, senderMatch, pattern, direction string) (*Template, error) {
+	t := &Template{
+		Name:      name,
+		Direction: direction,
+		Pattern:   pattern,
+	}
+	for _, s := range strings.Split(senderMatch, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			t.Senders = append(t.Senders, s)
+		}
+	}
+	if err := t.Compile(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Compile validates the template and prepares its pattern for matching
+func (t *Template) Compile() error {
+	if t.Direction != DirectionDebit && t.Direction != DirectionCredit {
+		return fmt.Errorf("template %q: direction must be %q or %q", t.Name, DirectionDebit, DirectionCredit)
+	}
+
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return fmt.Errorf("template %q: invalid pattern: %w", t.Name, err)
+	}
+
+	hasAmount := false
+	for _, name := range re.SubexpNames() {
+		if name == GroupAmount {
+			hasAmount = true
+		}
+	}
+	if !hasAmount {
+		return fmt.Errorf("template %q: pattern must contain a named group (?P<%s>...)", t.Name, GroupAmount)
+	}
+
+	t.re = re
+	return nil
+}
+
+// MatchesSender reports whether the template applies to the given sender
+func (t *Template) MatchesSender(sender string) bool {
+	if len(t.Senders) == 0 || sender == "" {
+		return true
+	}
+	sender = strings.ToUpper(sender)
+	for _, s := range t.Senders {
+		if strings.Contains(sender, strings.ToUpper(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs the template against raw text. It returns nil if the text
+// does not match or no usable amount could be extracted. Account digits
+// and reference numbers the pattern does not capture are looked up with
+// generic extractors.
+func (t *Template) Apply(rawText string) *Result {
+	if t.re == nil {
+		return nil
+	}
+
+	text := normalizeText(rawText)
+	match := t.re.FindStringSubmatch(text)
+	if match == nil {
+		return nil
+	}
+
+	groups := map[string]string{}
+	for i, name := range t.re.SubexpNames() {
+		if name != "" && match[i] != "" {
+			groups[name] = match[i]
+		}
+	}
+
+	amount, ok := parseAmount(groups[GroupAmount])
+	if !ok || amount <= 0 {
+		return nil
+	}
+
+	result := &Result{
+		Template:        t.Name,
+		Bank:            t.Bank,
+		Direction:       t.Direction,
+		Amount:          amount,
+		MerchantName:    cleanMerchant(groups[GroupMerchant]),
+		AccountLast4:    lastDigits(groups[GroupLast4], 4),
+		ReferenceNumber: strings.TrimSpace(groups[GroupReference]),
+	}
+	if balance, ok := parseAmount(groups[GroupBalance]); ok {
+		result.Balance = &balance
+	}
+
+	if result.AccountLast4 == "" {
+		if m := fallbackLast4.FindStringSubmatch(text); m != nil {
+			result.AccountLast4 = m[1]
+		}
+	}
+	if result.ReferenceNumber == "" {
+		if m := fallbackReference.FindStringSubmatch(text); m != nil {
+			result.ReferenceNumber = m[1]
+		}
+	}
+
+	return result
+}
+
+// Parse runs the built-in templates against a message
+func Parse(rawText, sender string) *Result {
+	return ParseWith(rawText, sender, nil)
+}
+
+// ParseWith tries the given templates first, in order, and falls back to
+// the built-in templates. Templates must already be compiled.
+func ParseWith(rawText, sender string, templates []*Template) *Result {
+	if result := firstMatch(rawText, sender, templates, func(t *Template) bool { return true }); result != nil {
+		return result
+	}
+	// Sender-specific built-ins first, then the generic ones
+	if result := firstMatch(rawText, sender, builtinTemplates, func(t *Template) bool { return len(t.Senders) > 0 }); result != nil {
+		return result
+	}
+	return firstMatch(rawText, sender, builtinTemplates, func(t *Template) bool { return len(t.Senders) == 0 })
+}
+
+// firstMatch returns the result of the first eligible template that matches
+func firstMatch(rawText, sender string, templates []*Template, eligible func(*Template) bool) *Result {
+	for _, t := range templates {
+		if !eligible(t) || !t.MatchesSender(sender) {
+			continue
+		}
+		if result := t.Apply(rawText); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
+// normalizeText collapses whitespace so templates don't have to cope with line breaks
+func normalizeText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseAmount parses amounts such as "1,250.00"
+func parseAmount(s string) (float64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// lastDigits returns the trailing n digits of s, or "" if it has fewer
+func lastDigits(s string, n int) string {
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits = append(digits, s[i])
+		}
+	}
+	if len(digits) < n {
+		return ""
+	}
+	return string(digits[len(digits)-n:])
+}
+
+// cleanMerchant trims punctuation that templates tend to capture around merchant names
+func cleanMerchant(s string) string {
+	return strings.Trim(strings.TrimSpace(s), ".,;:-")
+}
@@ -0,0 +1,345 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		sender    string
+		text      string
+		template  string
+		direction string
+		amount    float64
+		merchant  string
+		last4     string
+		ref       string
+		balance   float64
+	}{
+		{
+			name:      "HDFC UPI debit",
+			sender:    "VM-HDFCBK",
+			text:      "Rs.500.00 debited from a/c **1234 on 05-10-24 to VPA swiggy@icici (UPI Ref No 427812345678). Not you? Call 18002586161",
+			template:  "hdfc-upi-debit",
+			direction: DirectionDebit,
+			amount:    500,
+			merchant:  "swiggy@icici",
+			last4:     "1234",
+			ref:       "427812345678",
+		},
+		{
+			name:      "HDFC UPI sent over several lines",
+			sender:    "AD-HDFCBK",
+			text:      "Sent Rs.250.00\nFrom HDFC Bank A/C *5678\nTo Zomato Ltd\nOn 05/10/24\nRef 427898765432\nNot You?\nCall 18002586161/SMS BLOCK UPI to 7308080808",
+			template:  "hdfc-upi-sent",
+			direction: DirectionDebit,
+			amount:    250,
+			merchant:  "Zomato Ltd",
+			last4:     "5678",
+			ref:       "427898765432",
+		},
+		{
+			name:      "HDFC card spend",
+			sender:    "JD-HDFCBK",
+			text:      "Spent Rs.1,299 On HDFC Bank Card 9012 At AMAZON PAY INDIA On 2024-10-05:14:22:10 Not You? To Block+Reissue Call 18002586161",
+			template:  "hdfc-card-spend",
+			direction: DirectionDebit,
+			amount:    1299,
+			merchant:  "AMAZON PAY INDIA",
+			last4:     "9012",
+		},
+		{
+			name:      "HDFC UPI credit",
+			sender:    "VM-HDFCBK",
+			text:      "Rs. 1500.00 credited to a/c XXXXXX3456 on 06-10-24 by a/c linked to VPA rahul@okaxis (UPI Ref No. 428011112222).",
+			template:  "hdfc-upi-credit",
+			direction: DirectionCredit,
+			amount:    1500,
+			merchant:  "rahul@okaxis",
+			last4:     "3456",
+			ref:       "428011112222",
+		},
+		{
+			name:      "SBI UPI debit",
+			sender:    "VK-SBIUPI",
+			text:      "Dear UPI user A/C X4321 debited by 120.0 on date 07Oct24 trf to CHAI POINT Refno 428123456789. If not u? call 1800111109. -SBI",
+			template:  "sbi-upi-debit",
+			direction: DirectionDebit,
+			amount:    120,
+			merchant:  "CHAI POINT",
+			last4:     "4321",
+			ref:       "428123456789",
+		},
+		{
+			name:      "SBI UPI credit",
+			sender:    "BZ-SBIUPI",
+			text:      "Dear SBI UPI User, ur A/C X4321 credited by Rs.2000 on 08Oct24 by PRIYA SHARMA (Ref no 428200001111) -SBI",
+			template:  "sbi-upi-credit",
+			direction: DirectionCredit,
+			amount:    2000,
+			merchant:  "PRIYA SHARMA",
+			last4:     "4321",
+			ref:       "428200001111",
+		},
+		{
+			name:      "SBI credit card spend",
+			sender:    "AX-SBICRD",
+			text:      "Rs.799.00 spent on your SBI Credit Card ending with 7788 at NETFLIX on 09/10/24. Trxn. not done by you? Report at https://sbicard.com/Dispute",
+			template:  "sbi-card-spend",
+			direction: DirectionDebit,
+			amount:    799,
+			merchant:  "NETFLIX",
+			last4:     "7788",
+		},
+		{
+			name:      "ICICI UPI debit",
+			sender:    "AD-ICICIB",
+			text:      "ICICI Bank Acct XX1234 debited for Rs 340.00 on 10-Oct-24; BLINKIT credited. UPI:428312345678. Call 18002662 for dispute. SMS BLOCK 234 to 9215676766.",
+			template:  "icici-upi-debit",
+			direction: DirectionDebit,
+			amount:    340,
+			merchant:  "BLINKIT",
+			last4:     "1234",
+			ref:       "428312345678",
+		},
+		{
+			name:      "ICICI UPI credit",
+			sender:    "VM-ICICIB",
+			text:      "Dear Customer, Acct XX1234 is credited with Rs 5000.00 on 11-Oct-24 from ANIL KUMAR. UPI:428412345678-ICICI Bank.",
+			template:  "icici-upi-credit",
+			direction: DirectionCredit,
+			amount:    5000,
+			merchant:  "ANIL KUMAR",
+			last4:     "1234",
+			ref:       "428412345678",
+		},
+		{
+			name:      "ICICI card spend with available limit",
+			sender:    "JM-ICICIB",
+			text:      "INR 2,450.00 spent using ICICI Bank Card XX5566 on 12-Oct-24 on MYNTRA. Avl Limit: INR 1,20,000.00. If not you, call 1800 2662/SMS BLOCK 5566 to 9215676766.",
+			template:  "icici-card-spend",
+			direction: DirectionDebit,
+			amount:    2450,
+			merchant:  "MYNTRA",
+			last4:     "5566",
+			balance:   120000,
+		},
+		{
+			name:      "Axis UPI debit",
+			sender:    "AX-AXISBK",
+			text:      "INR 150.00 debited\nA/c no. XX2345\n13-10-24, 10:15:32\nUPI/P2M/428512345678/RAPIDO\nNot you? SMS BLOCKUPI Cust ID to 919951860002\nAxis Bank",
+			template:  "axis-upi-debit",
+			direction: DirectionDebit,
+			amount:    150,
+			merchant:  "RAPIDO",
+			last4:     "2345",
+			ref:       "428512345678",
+		},
+		{
+			name:      "Axis UPI credit",
+			sender:    "VM-AXISBK",
+			text:      "INR 900.00 credited\nA/c no. XX2345\n13-10-24, 18:40:05 IST\nUPI/P2A/428512340000/SURESH M\nNot you? SMS BLOCKUPI Cust ID to 919951860002\nAxis Bank",
+			template:  "axis-upi-credit",
+			direction: DirectionCredit,
+			amount:    900,
+			merchant:  "SURESH M",
+			last4:     "2345",
+			ref:       "428512340000",
+		},
+		{
+			name:      "Axis card spend",
+			sender:    "AD-AXISBK",
+			text:      "Spent INR 899\nAxis Bank Card no. XX6789\n14-10-24 19:02:11 IST\nBOOKMYSHOW\nAvl Limit: INR 45000.50\nNot you? SMS BLOCK 6789 to 919951860002\nAxis Bank",
+			template:  "axis-card-spend",
+			direction: DirectionDebit,
+			amount:    899,
+			merchant:  "BOOKMYSHOW",
+			last4:     "6789",
+			balance:   45000.5,
+		},
+		{
+			name:      "Kotak UPI sent",
+			sender:    "AX-KOTAKB",
+			text:      "Sent Rs.60.00 from Kotak Bank AC X9988 to paytmqr@paytm on 15-10-24.UPI Ref 428612345678. Not you, https://kotak.com/KBANKT/Fraud",
+			template:  "kotak-upi-sent",
+			direction: DirectionDebit,
+			amount:    60,
+			merchant:  "paytmqr@paytm",
+			last4:     "9988",
+			ref:       "428612345678",
+		},
+		{
+			name:      "Kotak UPI received",
+			sender:    "VM-KOTAKB",
+			text:      "Received Rs.700.00 in your Kotak Bank AC X9988 from neha@oksbi on 16-10-24.UPI Ref:428712345678.",
+			template:  "kotak-upi-received",
+			direction: DirectionCredit,
+			amount:    700,
+			merchant:  "neha@oksbi",
+			last4:     "9988",
+			ref:       "428712345678",
+		},
+		{
+			name:      "Amex card spend keeps the last four of five digits",
+			sender:    "AD-AMEXIN",
+			text:      "Alert: You've spent INR 3,200.00 on your AMEX card ** 41005 at TAJ HOTELS on 17 October 2024 at 08:30 PM IST. Call 18004191030 if this was not made by you.",
+			template:  "amex-card-spend",
+			direction: DirectionDebit,
+			amount:    3200,
+			merchant:  "TAJ HOTELS",
+			last4:     "1005",
+		},
+		{
+			name:      "bank format from another sender falls back to the generic templates",
+			sender:    "AX-AXISBK",
+			text:      "Rs.500.00 debited from a/c **1234 on 05-10-24 to VPA swiggy@icici (UPI Ref No 427812345678).",
+			template:  "generic-debit-amount-first",
+			direction: DirectionDebit,
+			amount:    500,
+			last4:     "1234",
+			ref:       "427812345678",
+		},
+		{
+			name:      "generic debit with account and reference from the fallback extractors",
+			sender:    "VM-PAYTMB",
+			text:      "Rs 450 debited from your account ending 4455 for UPI txn Ref 428812345678",
+			template:  "generic-debit-amount-first",
+			direction: DirectionDebit,
+			amount:    450,
+			last4:     "4455",
+			ref:       "428812345678",
+		},
+		{
+			name:      "generic debit verb first",
+			text:      "Your a/c XX7766 has been debited by INR 1,000.00 towards NEFT txn. UPI: 428912345678",
+			template:  "generic-debit-verb-first",
+			direction: DirectionDebit,
+			amount:    1000,
+			last4:     "7766",
+			ref:       "428912345678",
+		},
+		{
+			name:      "generic credit amount first",
+			sender:    "JM-BOBTXN",
+			text:      "₹2,500.00 credited to your card no. XX3344 on 18-10-24. Reference no. 429012345678",
+			template:  "generic-credit-amount-first",
+			direction: DirectionCredit,
+			amount:    2500,
+			last4:     "3344",
+			ref:       "429012345678",
+		},
+		{
+			name:      "generic credit verb first without account or reference",
+			text:      "Refunded INR 349 for your order 4021 from Flipkart",
+			template:  "generic-credit-verb-first",
+			direction: DirectionCredit,
+			amount:    349,
+		},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			covered[tt.template] = true
+
+			got := Parse(tt.text, tt.sender)
+			if got == nil {
+				t.Fatalf("Parse() = nil, want template %q", tt.template)
+			}
+			if got.Template != tt.template {
+				t.Errorf("Template = %q, want %q", got.Template, tt.template)
+			}
+			if got.Direction != tt.direction {
+				t.Errorf("Direction = %q, want %q", got.Direction, tt.direction)
+			}
+			if got.Amount != tt.amount {
+				t.Errorf("Amount = %v, want %v", got.Amount, tt.amount)
+			}
+			if got.MerchantName != tt.merchant {
+				t.Errorf("MerchantName = %q, want %q", got.MerchantName, tt.merchant)
+			}
+			if got.AccountLast4 != tt.last4 {
+				t.Errorf("AccountLast4 = %q, want %q", got.AccountLast4, tt.last4)
+			}
+			if got.ReferenceNumber != tt.ref {
+				t.Errorf("ReferenceNumber = %q, want %q", got.ReferenceNumber, tt.ref)
+			}
+			switch {
+			case tt.balance == 0 && got.Balance != nil:
+				t.Errorf("Balance = %v, want none", *got.Balance)
+			case tt.balance != 0 && (got.Balance == nil || *got.Balance != tt.balance):
+				t.Errorf("Balance = %v, want %v", got.Balance, tt.balance)
+			}
+		})
+	}
+
+	for _, tmpl := range builtinTemplates {
+		if !covered[tmpl.Name] {
+			t.Errorf("built-in template %q has no sample message", tmpl.Name)
+		}
+	}
+}
+
+func TestParseNoMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender string
+		text   string
+	}{
+		{name: "no amount", text: "Your OTP for login is 482913. Do not share it with anyone."},
+		{name: "zero amount", sender: "VM-HDFCBK", text: "Rs.0.00 debited from a/c **1234 on 05-10-24 to VPA test@icici (UPI Ref No 427812345678)."},
+		{name: "amount without a direction", text: "Your bill of Rs 1,200 is due on 20-10-24."},
+		{name: "empty", text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.text, tt.sender); got != nil {
+				t.Errorf("Parse() = template %q, want nil", got.Template)
+			}
+		})
+	}
+}
+
+func TestParseWithUserTemplates(t *testing.T) {
+	custom, err := NewTemplate("mybank-debit", "MYBANK, MYBNK", `(?i)Paid (?P<amount>[\d,]+) to (?P<merchant>.+?) from card (?P<last4>\d{4})`, DirectionDebit)
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	templates := []*Template{custom}
+
+	got := ParseWith("Paid 1,250 to Corner Cafe. from card 8899", "VM-MYBNK", templates)
+	if got == nil || got.Template != "mybank-debit" {
+		t.Fatalf("ParseWith() = %+v, want template mybank-debit", got)
+	}
+	if got.Amount != 1250 || got.MerchantName != "Corner Cafe" || got.AccountLast4 != "8899" {
+		t.Errorf("ParseWith() = %+v", got)
+	}
+
+	// Another sender skips the user template and falls back to the built-ins
+	got = ParseWith("Rs 90 debited. Paid 90 to Corner Cafe from card 8899", "VM-OTHER", templates)
+	if got == nil || got.Template != "generic-debit-amount-first" {
+		t.Errorf("ParseWith() from another sender = %+v, want template generic-debit-amount-first", got)
+	}
+}
+
+func TestNewTemplateValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		direction string
+	}{
+		{name: "bad direction", pattern: `(?P<amount>\d+)`, direction: "outgoing"},
+		{name: "invalid pattern", pattern: `(?P<amount>\d+`, direction: DirectionDebit},
+		{name: "no amount group", pattern: `Paid (\d+)`, direction: DirectionCredit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTemplate(tt.name, "", tt.pattern, tt.direction); err == nil {
+				t.Errorf("NewTemplate() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+)
+
+//go:embed templates/*.json
+var templateFS embed.FS
+
+// builtinTemplates is the embedded template library, in file then declaration order
+var builtinTemplates []*Template
+
+// Fallback extractors used when a template matched but did not capture these fields
+var (
+	fallbackLast4     = regexp.MustCompile(`(?i)(?:a/c|acct|account|card)(?: no\.?)?(?: ending)?(?: with)?\s*[x*]*\s*(\d{4})\b`)
+	fallbackReference = regexp.MustCompile(`(?i)(?:ref(?:erence)?\.?(?: ?no\.?)?|UPI)[:\s]*(\d{6,})`)
+)
+
+func init() {
+	templates, err := loadBuiltinTemplates()
+	if err != nil {
+		panic(err)
+	}
+	builtinTemplates = templates
+}
+
+// loadBuiltinTemplates reads and compiles every embedded template file
+func loadBuiltinTemplates() ([]*Template, error) {
+	files, err := templateFS.ReadDir("templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded templates: %w", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+
+	var templates []*Template
+	for _, name := range names {
+		content, err := templateFS.ReadFile(path.Join("templates", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file %s: %w", name, err)
+		}
+
+		var fileTemplates []*Template
+		if err := json.Unmarshal(content, &fileTemplates); err != nil {
+			return nil, fmt.Errorf("failed to decode template file %s: %w", name, err)
+		}
+
+		for _, t := range fileTemplates {
+			if err := t.Compile(); err != nil {
+				return nil, fmt.Errorf("template file %s: %w", name, err)
+			}
+			templates = append(templates, t)
+		}
+	}
+
+	return templates, nil
+}
@@ -0,0 +1,160 @@
+// Package patternpack reads and writes merchant patterns in the portable
+// format used to move them between accounts. Patterns refer to their category
+// by name, so a pack can be imported by any user.
+//
+// The JSON form is a models.PatternPack. The CSV form starts with a
+// "version,<n>" line, then a header line, then one pattern per line:
+//
+//	version,2
+//	merchant_name,match_type,category,priority,is_active,fuzzy_threshold
+//	Amazon,contains,Shopping,0,true,
+//	Starbucks Coffee,fuzzy,Food & Dining,0,true,0.6
+//
+// Version 1 packs, which predate fuzzy patterns and have no fuzzy_threshold
+// column, are still read.
+package patternpack
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Version is the pack format version written by this package
+const Version = 2
+
+// minVersion is the oldest pack format version this package reads
+const minVersion = 1
+
+var csvHeader = []string{"merchant_name", "match_type", "category", "priority", "is_active", "fuzzy_threshold"}
+
+// csvHeaderV1 is the header of version 1 packs, which lack fuzzy_threshold
+var csvHeaderV1 = csvHeader[:5]
+
+// WriteCSV writes the pack in CSV form
+func WriteCSV(w io.Writer, pack models.PatternPack) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"version", strconv.Itoa(pack.Version)}); err != nil {
+		return err
+	}
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, p := range pack.Patterns {
+		isActive := p.IsActive == nil || *p.IsActive
+		threshold := ""
+		if p.FuzzyThreshold != nil {
+			threshold = strconv.FormatFloat(*p.FuzzyThreshold, 'f', -1, 64)
+		}
+		err := cw.Write([]string{p.MerchantName, p.MatchType, p.Category, strconv.Itoa(p.Priority), strconv.FormatBool(isActive), threshold})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads a pack in CSV form
+func ReadCSV(r io.Reader) (models.PatternPack, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var pack models.PatternPack
+	record, err := cr.Read()
+	if err != nil {
+		return pack, fmt.Errorf("missing version line: %w", err)
+	}
+	if len(record) != 2 || record[0] != "version" {
+		return pack, fmt.Errorf("first line must be version,%d", Version)
+	}
+	pack.Version, err = strconv.Atoi(record[1])
+	if err != nil {
+		return pack, fmt.Errorf("invalid version %q", record[1])
+	}
+	if err := checkVersion(pack.Version); err != nil {
+		return pack, err
+	}
+
+	header := csvHeader
+	if pack.Version == 1 {
+		header = csvHeaderV1
+	}
+	record, err = cr.Read()
+	if err != nil {
+		return pack, fmt.Errorf("missing header line: %w", err)
+	}
+	if strings.Join(record, ",") != strings.Join(header, ",") {
+		return pack, fmt.Errorf("second line must be %s", strings.Join(header, ","))
+	}
+
+	pack.Patterns = []models.PatternPackEntry{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pack, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(header) {
+			return pack, fmt.Errorf("line %d: expected %d fields, got %d", line, len(header), len(record))
+		}
+
+		entry := models.PatternPackEntry{
+			MerchantName: record[0],
+			MatchType:    record[1],
+			Category:     record[2],
+		}
+		if record[3] != "" {
+			if entry.Priority, err = strconv.Atoi(record[3]); err != nil {
+				return pack, fmt.Errorf("line %d: invalid priority %q", line, record[3])
+			}
+		}
+		if record[4] != "" {
+			isActive, err := strconv.ParseBool(record[4])
+			if err != nil {
+				return pack, fmt.Errorf("line %d: invalid is_active %q", line, record[4])
+			}
+			entry.IsActive = &isActive
+		}
+		if len(record) > 5 && record[5] != "" {
+			threshold, err := strconv.ParseFloat(record[5], 64)
+			if err != nil {
+				return pack, fmt.Errorf("line %d: invalid fuzzy_threshold %q", line, record[5])
+			}
+			entry.FuzzyThreshold = &threshold
+		}
+		pack.Patterns = append(pack.Patterns, entry)
+	}
+	return pack, nil
+}
+
+// ReadJSON reads a pack in JSON form
+func ReadJSON(r io.Reader) (models.PatternPack, error) {
+	var pack models.PatternPack
+	if err := json.NewDecoder(r).Decode(&pack); err != nil {
+		return pack, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := checkVersion(pack.Version); err != nil {
+		return pack, err
+	}
+	if pack.Patterns == nil {
+		pack.Patterns = []models.PatternPackEntry{}
+	}
+	return pack, nil
+}
+
+func checkVersion(version int) error {
+	if version < minVersion || version > Version {
+		return fmt.Errorf("unsupported pack version %d, expected %d to %d", version, minVersion, Version)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+// Package place groups a user's location fixes into places: spots such as a
+// mall or an office where the phone keeps being seen. Each place has a
+// centroid and a radius covering its fixes, and expenses belong to the place
+// of the fix they are linked to.
+package place
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Point is a latitude and longitude in degrees
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// earthRadius is the mean radius of the earth in metres
+const earthRadius = 6371000
+
+// MetresPerDegree is the length of a degree of latitude in metres
+const MetresPerDegree = 111320
+
+// Distance returns the great-circle distance between two points in metres
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Cluster is a group of points
+type Cluster struct {
+	Center Point
+	// Radius is the distance in metres from the center to the farthest member
+	Radius  float64
+	Members []int
+}
+
+// Group clusters points in order. Each point joins the cluster whose center
+// is nearest, if that is within maxRadius metres, and moves its center to the
+// mean of its members; otherwise it starts a new cluster. Assign makes the
+// same choice for one new point against stored places.
+func Group(points []Point, maxRadius float64) []Cluster {
+	clusters := []Cluster{}
+	for i, p := range points {
+		best, bestDistance := -1, 0.0
+		for j := range clusters {
+			if d := Distance(clusters[j].Center, p); d <= maxRadius && (best == -1 || d < bestDistance) {
+				best, bestDistance = j, d
+			}
+		}
+		if best == -1 {
+			clusters = append(clusters, Cluster{Center: p, Members: []int{i}})
+			continue
+		}
+		c := &clusters[best]
+		c.Center = mean(c.Center, len(c.Members), p)
+		c.Members = append(c.Members, i)
+	}
+
+	for j := range clusters {
+		c := &clusters[j]
+		for _, i := range c.Members {
+			c.Radius = math.Max(c.Radius, Distance(c.Center, points[i]))
+		}
+	}
+	return clusters
+}
+
+// mean moves a center of n points to include p
+func mean(center Point, n int, p Point) Point {
+	w := float64(n)
+	return Point{
+		Latitude:  (center.Latitude*w + p.Latitude) / (w + 1),
+		Longitude: (center.Longitude*w + p.Longitude) / (w + 1),
+	}
+}
+
+// Assign puts a stored fix into the user's nearest place within maxRadius
+// metres, moving the place's center to take it in, or creates a new place for
+// it. The radius of a place that moves is widened by the distance it moved,
+// so it still covers the earlier fixes. It returns the place's id.
+func Assign(q Querier, userID, locationID uuid.UUID, p Point, maxRadius float64, now time.Time) (uuid.UUID, error) {
+	// Only places whose center is inside a box around the fix can be near enough
+	dLat := maxRadius / MetresPerDegree
+	dLng := 180.0
+	if cos := math.Cos(p.Latitude * math.Pi / 180); cos > 0.01 {
+		dLng = maxRadius / (MetresPerDegree * cos)
+	}
+	rows, err := q.Query(`
+		SELECT id, latitude, longitude, radius, fix_count FROM places
+		WHERE user_id = $1 AND latitude BETWEEN $2 AND $3 AND longitude BETWEEN $4 AND $5
+		ORDER BY created_at ASC, id ASC
+		FOR UPDATE
+	`, userID, p.Latitude-dLat, p.Latitude+dLat, p.Longitude-dLng, p.Longitude+dLng)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get places: %w", err)
+	}
+	var best struct {
+		id       uuid.UUID
+		center   Point
+		radius   float64
+		fixCount int
+	}
+	bestDistance := -1.0
+	for rows.Next() {
+		var id uuid.UUID
+		var center Point
+		var radius float64
+		var fixCount int
+		if err := rows.Scan(&id, &center.Latitude, &center.Longitude, &radius, &fixCount); err != nil {
+			rows.Close()
+			return uuid.Nil, fmt.Errorf("failed to scan place: %w", err)
+		}
+		if d := Distance(center, p); d <= maxRadius && (bestDistance < 0 || d < bestDistance) {
+			best.id, best.center, best.radius, best.fixCount = id, center, radius, fixCount
+			bestDistance = d
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get places: %w", err)
+	}
+
+	placeID := best.id
+	if bestDistance < 0 {
+		err = q.QueryRow(`
+			INSERT INTO places (user_id, latitude, longitude, radius, fix_count, created_at, updated_at)
+			VALUES ($1, $2, $3, 0, 1, $4, $4)
+			RETURNING id
+		`, userID, p.Latitude, p.Longitude, now).Scan(&placeID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to create place: %w", err)
+		}
+	} else {
+		center := mean(best.center, best.fixCount, p)
+		radius := math.Max(best.radius+Distance(best.center, center), Distance(center, p))
+		_, err = q.Exec(`
+			UPDATE places SET latitude = $1, longitude = $2, radius = $3, fix_count = fix_count + 1, updated_at = $4
+			WHERE id = $5
+		`, center.Latitude, center.Longitude, radius, now, placeID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to update place: %w", err)
+		}
+	}
+
+	if _, err := q.Exec("UPDATE locations SET place_id = $1 WHERE id = $2", placeID, locationID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to link location to place: %w", err)
+	}
+	return placeID, nil
+}
+
+// Rebuild clusters all of the user's fixes from scratch, in the order they
+// were recorded, replacing the user's places. Fixes whose accuracy radius is
+// above maxAccuracy metres are left out, unless maxAccuracy is 0. A new place
+// keeps the name of the nearest old named place its center is within
+// maxRadius of, each name going to at most one place. It returns the number
+// of places.
+func Rebuild(q Querier, userID uuid.UUID, maxRadius, maxAccuracy float64, now time.Time) (int, error) {
+	type named struct {
+		name   string
+		center Point
+		used   bool
+	}
+	rows, err := q.Query("SELECT name, latitude, longitude FROM places WHERE user_id = $1 AND name IS NOT NULL ORDER BY updated_at DESC, id ASC", userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get places: %w", err)
+	}
+	names := []*named{}
+	for rows.Next() {
+		n := &named{}
+		if err := rows.Scan(&n.name, &n.center.Latitude, &n.center.Longitude); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan place: %w", err)
+		}
+		names = append(names, n)
+	}
+	rows.Close()
+
+	rows, err = q.Query(`
+		SELECT id, latitude, longitude FROM locations
+		WHERE user_id = $1 AND ($2::float8 = 0 OR accuracy IS NULL OR accuracy <= $2::float8)
+		ORDER BY timestamp ASC, id ASC
+	`, userID, maxAccuracy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get locations: %w", err)
+	}
+	ids := []uuid.UUID{}
+	points := []Point{}
+	for rows.Next() {
+		var id uuid.UUID
+		var p Point
+		if err := rows.Scan(&id, &p.Latitude, &p.Longitude); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan location: %w", err)
+		}
+		ids = append(ids, id)
+		points = append(points, p)
+	}
+	rows.Close()
+
+	// Deleting the places unlinks every fix
+	if _, err := q.Exec("DELETE FROM places WHERE user_id = $1", userID); err != nil {
+		return 0, fmt.Errorf("failed to delete places: %w", err)
+	}
+
+	for _, c := range Group(points, maxRadius) {
+		var name *string
+		var nearest *named
+		for _, n := range names {
+			if d := Distance(n.center, c.Center); !n.used && d <= maxRadius && (nearest == nil || d < Distance(nearest.center, c.Center)) {
+				nearest = n
+			}
+		}
+		if nearest != nil {
+			nearest.used = true
+			name = &nearest.name
+		}
+
+		var placeID uuid.UUID
+		err := q.QueryRow(`
+			INSERT INTO places (user_id, name, latitude, longitude, radius, fix_count, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+			RETURNING id
+		`, userID, name, c.Center.Latitude, c.Center.Longitude, c.Radius, len(c.Members), now).Scan(&placeID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create place: %w", err)
+		}
+
+		members := make([]string, len(c.Members))
+		for i, m := range c.Members {
+			members[i] = ids[m].String()
+		}
+		if _, err := q.Exec("UPDATE locations SET place_id = $1 WHERE id = ANY($2::uuid[])", placeID, pq.Array(members)); err != nil {
+			return 0, fmt.Errorf("failed to link locations to place: %w", err)
+		}
+	}
+
+	var count int
+	err = q.QueryRow("SELECT COUNT(*) FROM places WHERE user_id = $1", userID).Scan(&count)
+	return count, err
+}
+
+// Suggestion thresholds: a place needs this many categorised expenses, and
+// its most common category must cover more than this share of them
+const (
+	minSuggestionExpenses = 2
+	minSuggestionShare    = 0.5
+)
+
+// SuggestCategory returns the dominant category of the place the fix belongs
+// to, if it has one: the category of most of the verified expenses at the
+// place, other than the expense given. It returns nil when the fix has no
+// place or no category dominates.
+func SuggestCategory(q Querier, userID, locationID, expenseID uuid.UUID) (*models.PlaceCategorySuggestion, error) {
+	var s models.PlaceCategorySuggestion
+	var name sql.NullString
+	var total int
+	err := q.QueryRow(`
+		WITH spent AS (
+			SELECT e.category_id, COUNT(*) AS expenses
+			FROM locations fix
+			JOIN locations l ON l.place_id = fix.place_id
+			JOIN expenses e ON e.location_id = l.id AND e.user_id = $1
+			WHERE fix.id = $2 AND fix.user_id = $1 AND e.id <> $3 AND e.verified = true
+			GROUP BY e.category_id
+		)
+		SELECT p.id, p.name, s.category_id, s.expenses, (SELECT SUM(expenses) FROM spent)
+		FROM locations fix
+		JOIN places p ON p.id = fix.place_id
+		CROSS JOIN spent s
+		WHERE fix.id = $2
+		ORDER BY s.expenses DESC, s.category_id ASC
+		LIMIT 1
+	`, userID, locationID, expenseID).Scan(&s.PlaceID, &name, &s.CategoryID, &s.ExpenseCount, &total)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get place category: %w", err)
+	}
+
+	s.PlaceName = name.String
+	s.Share = float64(s.ExpenseCount) / float64(total)
+	if total < minSuggestionExpenses || s.Share <= minSuggestionShare {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// DominantCategories returns, for each of the user's places with one, the
+// category that dominates its verified expenses by the same measure as
+// SuggestCategory
+func DominantCategories(q Querier, userID uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	rows, err := q.Query(`
+		SELECT l.place_id, e.category_id, COUNT(*)
+		FROM expenses e
+		JOIN locations l ON l.id = e.location_id
+		WHERE e.user_id = $1 AND e.verified = true AND l.place_id IS NOT NULL
+		GROUP BY l.place_id, e.category_id
+		ORDER BY l.place_id, COUNT(*) DESC, e.category_id ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get place categories: %w", err)
+	}
+	defer rows.Close()
+
+	type tally struct {
+		top        uuid.UUID
+		topCount   int
+		totalCount int
+	}
+	tallies := map[uuid.UUID]*tally{}
+	for rows.Next() {
+		var placeID, categoryID uuid.UUID
+		var count int
+		if err := rows.Scan(&placeID, &categoryID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan place category: %w", err)
+		}
+		t := tallies[placeID]
+		if t == nil {
+			// Rows come most common first
+			t = &tally{top: categoryID, topCount: count}
+			tallies[placeID] = t
+		}
+		t.totalCount += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get place categories: %w", err)
+	}
+
+	dominant := map[uuid.UUID]uuid.UUID{}
+	for placeID, t := range tallies {
+		if t.totalCount >= minSuggestionExpenses && float64(t.topCount)/float64(t.totalCount) > minSuggestionShare {
+			dominant[placeID] = t.top
+		}
+	}
+	return dominant, nil
+}
@@ -0,0 +1,339 @@
+// Package processor promotes parsed transactions into auto-detected expenses and incomes.
+package processor
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/db"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/merchant"
+	"github.com/sooraj1002/expense-tracker/models"
+	"github.com/sooraj1002/expense-tracker/place"
+	"github.com/sooraj1002/expense-tracker/resolver"
+	"github.com/sooraj1002/expense-tracker/rules"
+)
+
+// DefaultCategoryID is the system "Other" category, used when no merchant pattern matches
+var DefaultCategoryID = uuid.MustParse("99999999-9999-9999-9999-999999999999")
+
+// DefaultIncomeCategoryID is the system "Other Income" category, used for credits
+var DefaultIncomeCategoryID = uuid.MustParse("a9999999-9999-9999-9999-999999999999")
+
+// ErrTransactionNotFound is returned when the transaction does not exist or belongs to another user
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrAccountNotFound is returned when an account chosen by the user does not exist or belongs to another user
+var ErrAccountNotFound = errors.New("account not found")
+
+// pendingTransaction holds the transaction fields the pipeline needs
+type pendingTransaction struct {
+	ID              uuid.UUID
+	RawText         string
+	SenderInfo      sql.NullString
+	Timestamp       time.Time
+	Amount          *float64
+	MerchantName    sql.NullString
+	AccountLast4    sql.NullString
+	Bank            sql.NullString
+	Direction       sql.NullString
+	Parsed          bool
+	Processed       bool
+	ExpenseID       *uuid.UUID
+	IncomeID        *uuid.UUID
+	DuplicateOf     *uuid.UUID
+	DuplicateStatus sql.NullString
+	LocationID      *uuid.UUID
+}
+
+// Process promotes a single transaction in its own database transaction.
+// Reprocessing a transaction that already has an expense or income returns it.
+func Process(userID, transactionID uuid.UUID) (models.TransactionProcessResult, error) {
+	return process(userID, transactionID, nil)
+}
+
+// ProcessWithAccount promotes a transaction into the given account, bypassing the
+// resolver. It is used to triage transactions the resolver could not place.
+func ProcessWithAccount(userID, transactionID, accountID uuid.UUID) (models.TransactionProcessResult, error) {
+	return process(userID, transactionID, &accountID)
+}
+
+// process runs the pipeline for one transaction in its own database transaction
+func process(userID, transactionID uuid.UUID, accountID *uuid.UUID) (models.TransactionProcessResult, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.TransactionProcessResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := processTx(tx, userID, transactionID, accountID)
+	if err != nil {
+		return result, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// ProcessPending processes every parsed transaction of the user that has not been processed yet
+func ProcessPending(userID uuid.UUID) ([]models.TransactionProcessResult, error) {
+	rows, err := db.DB.Query(`
+		SELECT id FROM transactions
+		WHERE user_id = $1 AND parsed = true AND processed = false AND (duplicate_of IS NULL OR duplicate_status = 'rejected')
+		ORDER BY timestamp ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending transactions: %w", err)
+	}
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending transaction: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	results := make([]models.TransactionProcessResult, 0, len(ids))
+	for _, id := range ids {
+		result, err := Process(userID, id)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// processTx runs the pipeline for one transaction. The transaction row is locked
+// so concurrent calls cannot both create an expense or income for it. Without an
+// explicit account, the resolver picks one; transactions it cannot place are
+// left unprocessed with an unassigned reason.
+func processTx(tx *sql.Tx, userID, transactionID uuid.UUID, accountID *uuid.UUID) (models.TransactionProcessResult, error) {
+	result := models.TransactionProcessResult{TransactionID: transactionID}
+
+	var t pendingTransaction
+	err := tx.QueryRow(`
+		SELECT id, raw_text, sender_info, timestamp, amount, merchant_name, account_last4, bank, direction, parsed, processed, expense_id, income_id, duplicate_of, duplicate_status, location_id
+		FROM transactions
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, transactionID, userID).Scan(&t.ID, &t.RawText, &t.SenderInfo, &t.Timestamp, &t.Amount, &t.MerchantName, &t.AccountLast4, &t.Bank, &t.Direction,
+		&t.Parsed, &t.Processed, &t.ExpenseID, &t.IncomeID, &t.DuplicateOf, &t.DuplicateStatus, &t.LocationID)
+	if err == sql.ErrNoRows {
+		return result, ErrTransactionNotFound
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if t.ExpenseID != nil || t.IncomeID != nil || t.Processed {
+		result.Status = models.ProcessStatusAlreadyProcessed
+		result.ExpenseID = t.ExpenseID
+		result.IncomeID = t.IncomeID
+		return result, nil
+	}
+
+	if reason := skipReason(t); reason != "" {
+		result.Status = models.ProcessStatusSkipped
+		result.Reason = reason
+		return result, nil
+	}
+
+	var account uuid.UUID
+	if accountID != nil {
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2)", *accountID, userID).Scan(&exists)
+		if err != nil {
+			return result, fmt.Errorf("failed to get account: %w", err)
+		}
+		if !exists {
+			return result, ErrAccountNotFound
+		}
+		account = *accountID
+	} else {
+		resolved, reason, err := resolver.Resolve(tx, userID, resolver.Input{
+			AccountLast4: t.AccountLast4.String,
+			Bank:         t.Bank.String,
+			SenderInfo:   t.SenderInfo.String,
+			RawText:      t.RawText,
+		})
+		if err != nil {
+			return result, err
+		}
+		if reason != "" {
+			if _, err := tx.Exec("UPDATE transactions SET unassigned_reason = $1, updated_at = $2 WHERE id = $3", reason, time.Now(), t.ID); err != nil {
+				return result, fmt.Errorf("failed to mark transaction unassigned: %w", err)
+			}
+			result.Status = models.ProcessStatusUnassigned
+			result.Reason = reason
+			return result, nil
+		}
+		account = resolved
+	}
+
+	if t.Direction.String == "credit" {
+		incomeID, err := createIncome(tx, userID, account, t)
+		if err != nil {
+			return result, err
+		}
+		result.Status = models.ProcessStatusCreated
+		result.IncomeID = &incomeID
+		return result, nil
+	}
+
+	expenseID, err := createExpense(tx, userID, account, t)
+	if err != nil {
+		return result, err
+	}
+	result.Status = models.ProcessStatusCreated
+	result.ExpenseID = &expenseID
+
+	// Without a merchant, the category usually spent on at the place is offered instead
+	if t.MerchantName.String == "" && t.LocationID != nil {
+		result.Suggestion, err = place.SuggestCategory(tx, userID, *t.LocationID, expenseID)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// createExpense records a debit as an auto expense linked to its merchant, categorised
+// by the merchant patterns and then the rules, lowers the account balance and marks
+// the transaction processed. The expense is unverified unless a rule says otherwise.
+func createExpense(tx *sql.Tx, userID, accountID uuid.UUID, t pendingTransaction) (uuid.UUID, error) {
+	categoryID := DefaultCategoryID
+	compiled, err := matcher.ForUser(tx, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to load merchant patterns: %w", err)
+	}
+	pattern := compiled.Match(t.MerchantName.String)
+	if pattern != nil {
+		categoryID = pattern.CategoryID
+	}
+
+	// Rules run after the patterns and can override what they picked
+	description, verified := "", false
+	evaluation, err := rules.Run(tx, userID, rules.Input{
+		MerchantName: t.MerchantName.String,
+		Amount:       *t.Amount,
+		AccountID:    &accountID,
+		Date:         t.Timestamp,
+		Source:       "auto",
+		RawText:      t.RawText,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if evaluation.Description != nil {
+		description = *evaluation.Description
+	}
+	if evaluation.Verified != nil {
+		verified = *evaluation.Verified
+	}
+	if evaluation.CategoryID != nil {
+		categoryID = *evaluation.CategoryID
+	}
+	// Every action the rules picked is applied here, so each rule behind one counts as used
+	if err := rules.RecordUse(tx, evaluation.CategoryRuleID, evaluation.DescriptionRuleID, evaluation.VerifiedRuleID); err != nil {
+		return uuid.Nil, err
+	}
+
+	merchantID, err := merchant.Upsert(tx, userID, t.MerchantName.String)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	now := time.Now()
+	var expenseID uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO expenses (user_id, amount, category_id, account_id, date, description, source, merchant_id, merchant_name, location_id, raw_data, verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id
+	`, userID, *t.Amount, categoryID, accountID, t.Timestamp, description, "auto", merchantID, t.MerchantName.String, t.LocationID, t.RawText, verified, now, now).Scan(&expenseID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create expense: %w", err)
+	}
+
+	if err := merchant.Refresh(tx, merchantID); err != nil {
+		return uuid.Nil, err
+	}
+
+	if pattern != nil {
+		// A pattern whose category a rule replaced matched but did not categorise the expense
+		categorised := &expenseID
+		if categoryID != pattern.CategoryID {
+			categorised = nil
+		}
+		if err := matcher.RecordMatch(tx, pattern, categorised, models.PatternMatchSourceAuto); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance - $1, total_spent = total_spent + $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, *t.Amount, now, accountID, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update account balance: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET processed = true, expense_id = $1, merchant_id = $2, unassigned_reason = NULL, updated_at = $3 WHERE id = $4", expenseID, merchantID, now, t.ID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to mark transaction processed: %w", err)
+	}
+	return expenseID, nil
+}
+
+// createIncome records a credit as an unverified auto income, raises the account
+// balance and marks the transaction processed
+func createIncome(tx *sql.Tx, userID, accountID uuid.UUID, t pendingTransaction) (uuid.UUID, error) {
+	now := time.Now()
+	var incomeID uuid.UUID
+	err := tx.QueryRow(`
+		INSERT INTO incomes (user_id, amount, category_id, account_id, date, description, source, payer_name, raw_data, verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`, userID, *t.Amount, DefaultIncomeCategoryID, accountID, t.Timestamp, "", "auto", t.MerchantName, t.RawText, false, now, now).Scan(&incomeID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create income: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE accounts
+		SET current_balance = current_balance + $1, total_income = total_income + $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4
+	`, *t.Amount, now, accountID, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update account balance: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET processed = true, income_id = $1, unassigned_reason = NULL, updated_at = $2 WHERE id = $3", incomeID, now, t.ID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to mark transaction processed: %w", err)
+	}
+	return incomeID, nil
+}
+
+// skipReason explains why a transaction cannot become an expense, or returns ""
+func skipReason(t pendingTransaction) string {
+	switch {
+	case t.DuplicateOf != nil && t.DuplicateStatus.String != models.DuplicateStatusRejected:
+		return "transaction is a duplicate of " + t.DuplicateOf.String()
+	case !t.Parsed || t.Amount == nil:
+		return "transaction has not been parsed"
+	case *t.Amount <= 0:
+		return "transaction amount must be greater than 0"
+	}
+	return ""
+}
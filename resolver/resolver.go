@@ -0,0 +1,148 @@
+// Package resolver maps parsed transactions to the account they were made
+// from, using the instrument identifiers registered on each account.
+package resolver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Input holds the transaction fields used to find its account
+type Input struct {
+	AccountLast4 string
+	Bank         string
+	SenderInfo   string
+	RawText      string
+}
+
+// match records which identifiers of one account matched a transaction
+type match struct {
+	strong bool // last-4 digits or UPI VPA
+	issuer bool
+}
+
+// NormalizeIdentifier validates an identifier value and returns it in the form it is stored in
+func NormalizeIdentifier(identifierType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch identifierType {
+	case models.IdentifierTypeLast4:
+		if len(value) != 4 || strings.Trim(value, "0123456789") != "" {
+			return "", errors.New("last4 must be exactly 4 digits")
+		}
+	case models.IdentifierTypeUPIVPA:
+		value = strings.ToLower(value)
+		if at := strings.Index(value, "@"); at <= 0 || at == len(value)-1 || strings.ContainsAny(value, " \t") {
+			return "", errors.New("upi_vpa must look like name@bank")
+		}
+	case models.IdentifierTypeIssuer:
+		if value == "" {
+			return "", errors.New("issuer must not be empty")
+		}
+	default:
+		return "", fmt.Errorf("unknown identifier type %q", identifierType)
+	}
+	return value, nil
+}
+
+// Resolve returns the user's account the transaction belongs to. When no single
+// account can be chosen, it returns uuid.Nil and a reason for the user to triage.
+//
+// Last-4 digits and UPI VPAs found in the message are strong evidence. An issuer
+// name only breaks ties between strong matches, or picks the account on its own
+// when the message carries no account digits and exactly one account has that issuer.
+func Resolve(q Querier, userID uuid.UUID, in Input) (uuid.UUID, string, error) {
+	rows, err := q.Query("SELECT account_id, type, value FROM account_identifiers WHERE user_id = $1", userID)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to load account identifiers: %w", err)
+	}
+	defer rows.Close()
+
+	rawText := strings.ToLower(in.RawText)
+	bank := strings.ToUpper(in.Bank)
+	sender := strings.ToUpper(in.SenderInfo)
+
+	matches := map[uuid.UUID]*match{}
+	for rows.Next() {
+		var accountID uuid.UUID
+		var identifierType, value string
+		if err := rows.Scan(&accountID, &identifierType, &value); err != nil {
+			return uuid.Nil, "", fmt.Errorf("failed to scan account identifier: %w", err)
+		}
+
+		m := matches[accountID]
+		if m == nil {
+			m = &match{}
+			matches[accountID] = m
+		}
+
+		switch identifierType {
+		case models.IdentifierTypeLast4:
+			m.strong = m.strong || (in.AccountLast4 != "" && value == in.AccountLast4)
+		case models.IdentifierTypeUPIVPA:
+			m.strong = m.strong || strings.Contains(rawText, value)
+		case models.IdentifierTypeIssuer:
+			issuer := strings.ToUpper(value)
+			m.issuer = m.issuer || (bank != "" && strings.Contains(bank, issuer)) || (sender != "" && strings.Contains(sender, issuer))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to load account identifiers: %w", err)
+	}
+
+	strong := filter(matches, func(m *match) bool { return m.strong })
+	switch {
+	case len(strong) == 1:
+		return strong[0], "", nil
+	case len(strong) > 1:
+		narrowed := filter(matches, func(m *match) bool { return m.strong && m.issuer })
+		if len(narrowed) == 1 {
+			return narrowed[0], "", nil
+		}
+		return uuid.Nil, describe("more than one account matches", in), nil
+	case in.AccountLast4 != "":
+		return uuid.Nil, describe("no account matches", in), nil
+	}
+
+	issuers := filter(matches, func(m *match) bool { return m.issuer })
+	switch len(issuers) {
+	case 1:
+		return issuers[0], "", nil
+	case 0:
+		return uuid.Nil, describe("no account matches", in), nil
+	default:
+		return uuid.Nil, describe("more than one account matches", in), nil
+	}
+}
+
+// filter returns the accounts whose match satisfies keep
+func filter(matches map[uuid.UUID]*match, keep func(*match) bool) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for id, m := range matches {
+		if keep(m) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// describe builds a triage reason naming what the transaction was matched on
+func describe(prefix string, in Input) string {
+	switch {
+	case in.AccountLast4 != "":
+		return prefix + " the last 4 digits " + in.AccountLast4
+	case in.Bank != "":
+		return prefix + " the issuer " + in.Bank
+	default:
+		return prefix + " this transaction"
+	}
+}
@@ -0,0 +1,220 @@
+// Package rules runs a user's categorisation rules against an expense.
+package rules
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sooraj1002/expense-tracker/matcher"
+	"github.com/sooraj1002/expense-tracker/models"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Columns is the column list Scan expects
+const Columns = "id, user_id, name, position, is_active, stop_processing, merchant_name, merchant_match_type, min_amount, max_amount, account_id, days_of_week, source, description_keywords, set_category_id, set_description, set_verified, use_count, last_used_at, created_at, updated_at"
+
+// Scanner is implemented by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Scan reads a rule selected with Columns
+func Scan(row Scanner) (models.Rule, error) {
+	var r models.Rule
+	err := row.Scan(&r.ID, &r.UserID, &r.Name, &r.Position, &r.IsActive, &r.StopProcessing,
+		&r.Conditions.MerchantName, &r.Conditions.MerchantMatchType, &r.Conditions.MinAmount, &r.Conditions.MaxAmount,
+		&r.Conditions.AccountID, &r.Conditions.DaysOfWeek, &r.Conditions.Source, &r.Conditions.DescriptionKeywords,
+		&r.Actions.CategoryID, &r.Actions.Description, &r.Actions.Verified,
+		&r.UseCount, &r.LastUsedAt, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// LoadActive returns the user's active rules in the order they run
+func LoadActive(q Querier, userID uuid.UUID) ([]models.Rule, error) {
+	rows, err := q.Query("SELECT "+Columns+" FROM rules WHERE user_id = $1 AND is_active = true ORDER BY position ASC, created_at ASC, id ASC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.Rule{}
+	for rows.Next() {
+		r, err := Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// Input is the expense a run looks at
+type Input struct {
+	MerchantName string
+	Amount       float64
+	AccountID    *uuid.UUID
+	Date         time.Time
+	Source       string
+	Description  string
+	// RawText is the bank message of an ingested expense, searched for
+	// description keywords along with Description
+	RawText string
+}
+
+// Evaluate runs the rules in order. Every rule whose conditions hold fires
+// and sets the fields in its actions, so a later rule overrides an earlier
+// one, until a firing rule has StopProcessing set.
+func Evaluate(rules []models.Rule, in Input) models.RuleEvaluation {
+	result := models.RuleEvaluation{Trace: []models.RuleTrace{}}
+	for _, r := range rules {
+		trace := models.RuleTrace{RuleID: r.ID, Name: r.Name}
+		if reason := check(r.Conditions, in); reason != "" {
+			trace.Reason = reason
+			result.Trace = append(result.Trace, trace)
+			continue
+		}
+
+		trace.Fired = true
+		id := r.ID
+		if r.Actions.CategoryID != nil {
+			result.CategoryID, result.CategoryRuleID = r.Actions.CategoryID, &id
+		}
+		if r.Actions.Description != nil {
+			result.Description, result.DescriptionRuleID = r.Actions.Description, &id
+		}
+		if r.Actions.Verified != nil {
+			result.Verified, result.VerifiedRuleID = r.Actions.Verified, &id
+		}
+		trace.Stopped = r.StopProcessing
+		result.Trace = append(result.Trace, trace)
+		if r.StopProcessing {
+			break
+		}
+	}
+	return result
+}
+
+// check returns why the conditions do not hold for the input, or "" if they do
+func check(c models.RuleConditions, in Input) string {
+	if c.MerchantName != nil {
+		p := models.MerchantPattern{MerchantName: *c.MerchantName, MatchType: matchType(c)}
+		if !matcher.Matches(p, in.MerchantName) {
+			return fmt.Sprintf("merchant %q does not match %s %q", in.MerchantName, p.MatchType, p.MerchantName)
+		}
+	}
+	if c.MinAmount != nil && in.Amount < *c.MinAmount {
+		return fmt.Sprintf("amount %.2f is below the minimum %.2f", in.Amount, *c.MinAmount)
+	}
+	if c.MaxAmount != nil && in.Amount > *c.MaxAmount {
+		return fmt.Sprintf("amount %.2f is above the maximum %.2f", in.Amount, *c.MaxAmount)
+	}
+	if c.AccountID != nil && (in.AccountID == nil || *in.AccountID != *c.AccountID) {
+		return "expense is on a different account"
+	}
+	if len(c.DaysOfWeek) > 0 {
+		day := in.Date.Weekday()
+		found := false
+		for _, d := range c.DaysOfWeek {
+			if time.Weekday(d) == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%s is not one of the rule's days", day)
+		}
+	}
+	if c.Source != nil && in.Source != *c.Source {
+		return fmt.Sprintf("source is %s, not %s", in.Source, *c.Source)
+	}
+	if len(c.DescriptionKeywords) > 0 {
+		text := strings.ToLower(in.Description + "\n" + in.RawText)
+		found := false
+		for _, keyword := range c.DescriptionKeywords {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "description contains none of the keywords"
+		}
+	}
+	return ""
+}
+
+// matchType returns the merchant match type of the conditions, contains by default
+func matchType(c models.RuleConditions) string {
+	if c.MerchantMatchType != nil {
+		return *c.MerchantMatchType
+	}
+	return models.MatchTypeContains
+}
+
+// Validate checks the parts of a rule that binding cannot: the merchant
+// pattern, the amount range, keywords and that there is something to do
+func Validate(c models.RuleConditions, a models.RuleActions) error {
+	if c.MerchantName != nil {
+		if err := matcher.Validate(matchType(c), *c.MerchantName); err != nil {
+			return fmt.Errorf("merchantName: %w", err)
+		}
+	} else if c.MerchantMatchType != nil {
+		return errors.New("merchantMatchType needs a merchantName")
+	}
+	if c.MinAmount != nil && c.MaxAmount != nil && *c.MinAmount > *c.MaxAmount {
+		return errors.New("minAmount must not be above maxAmount")
+	}
+	for _, keyword := range c.DescriptionKeywords {
+		if strings.TrimSpace(keyword) == "" {
+			return errors.New("descriptionKeywords must not contain empty keywords")
+		}
+	}
+	if a.CategoryID == nil && a.Description == nil && a.Verified == nil {
+		return errors.New("rule must have at least one action")
+	}
+	return nil
+}
+
+// Run evaluates the user's active rules against the input. It does not count
+// a use of any rule, since the caller decides which actions it applies; pass
+// the rules behind those to RecordUse.
+func Run(q Querier, userID uuid.UUID, in Input) (models.RuleEvaluation, error) {
+	rules, err := LoadActive(q, userID)
+	if err != nil {
+		return models.RuleEvaluation{}, fmt.Errorf("failed to load rules: %w", err)
+	}
+	return Evaluate(rules, in), nil
+}
+
+// RecordUse counts a use of each of the given rules. Nil and repeated IDs are
+// ignored, so the rule IDs of an evaluation can be passed as they are.
+func RecordUse(q Querier, ruleIDs ...*uuid.UUID) error {
+	ids := []string{}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range ruleIDs {
+		if id == nil || seen[*id] {
+			continue
+		}
+		seen[*id] = true
+		ids = append(ids, id.String())
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := q.Exec("UPDATE rules SET use_count = use_count + 1, last_used_at = $1 WHERE id = ANY($2::uuid[])", time.Now(), pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to record rule use: %w", err)
+	}
+	return nil
+}